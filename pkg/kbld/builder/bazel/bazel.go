@@ -5,10 +5,14 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
 	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
@@ -23,6 +27,7 @@ var (
 
 type Bazel struct {
 	docker ctlbdk.Docker
+	daemon ctlbdk.DockerDaemon
 	logger ctllog.Logger
 }
 
@@ -30,7 +35,14 @@ func NewBazel(docker ctlbdk.Docker, logger ctllog.Logger) Bazel {
 	return Bazel{docker: docker, logger: logger}
 }
 
-func (b *Bazel) Run(image, directory string, opts config.SourceBazelRunOpts) (ctlbdk.DockerTmpRef, error) {
+// WithDaemon returns Bazel that loads (and retags) images using given Docker daemon
+func (b Bazel) WithDaemon(daemon ctlbdk.DockerDaemon) Bazel {
+	b.docker = b.docker.WithDaemon(daemon)
+	b.daemon = daemon
+	return b
+}
+
+func (b *Bazel) Run(ctx context.Context, image, directory string, opts config.SourceBazelRunOpts) (ctlbdk.DockerTmpRef, error) {
 	prefixedLogger := b.logger.NewPrefixedWriter(image + " | ")
 
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using bazel): %s\n", directory)))
@@ -52,12 +64,16 @@ func (b *Bazel) Run(image, directory string, opts config.SourceBazelRunOpts) (ct
 			cmdArgs = append(cmdArgs, *opts.RawOptions...)
 		}
 
-		cmd := exec.Command("bazel", cmdArgs...)
+		cmd := exec.CommandContext(ctx, "bazel", cmdArgs...)
 		cmd.Dir = directory
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
+		// Image is loaded by a script executed by bazel run
+		b.daemon.AddEnv(cmd)
+
 		err := cmd.Run()
+		prefixedLogger.Flush()
 		if err != nil {
 			prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
 			return ctlbdk.DockerTmpRef{}, err
@@ -71,5 +87,97 @@ func (b *Bazel) Run(image, directory string, opts config.SourceBazelRunOpts) (ct
 		imageID = "sha256:" + matches[2]
 	}
 
-	return b.docker.RetagStable(ctlbdk.NewDockerTmpRef(imageID), image, imageID, prefixedLogger)
+	return b.docker.RetagStable(ctx, ctlbdk.NewDockerTmpRef(imageID), image, imageID, prefixedLogger)
+}
+
+// BazelBuildOutput is an image produced by bazel target
+// either as a tarball (rules_docker) or as an OCI layout directory (rules_oci)
+type BazelBuildOutput struct {
+	Path      string
+	OCILayout bool
+}
+
+// Build builds image target and returns path to its output
+func (b *Bazel) Build(ctx context.Context, image, directory string, opts config.SourceBazelBuildOpts) (BazelBuildOutput, error) {
+	prefixedLogger := b.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using bazel): %s\n", directory)))
+	defer prefixedLogger.Write([]byte("finished build (using bazel)\n"))
+
+	cmdArgs := []string{"build", opts.Target}
+
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	_, err := b.run(ctx, directory, cmdArgs, prefixedLogger)
+	if err != nil {
+		return BazelBuildOutput{}, err
+	}
+
+	outputs, err := b.outputFiles(ctx, directory, opts, prefixedLogger)
+	if err != nil {
+		return BazelBuildOutput{}, err
+	}
+
+	// oci_image (rules_oci) produces directory with OCI layout
+	for _, output := range outputs {
+		path := filepath.Join(directory, output)
+		if _, err := os.Stat(filepath.Join(path, "oci-layout")); err == nil {
+			return BazelBuildOutput{Path: path, OCILayout: true}, nil
+		}
+	}
+
+	for _, output := range outputs {
+		if strings.HasSuffix(output, ".tar") {
+			return BazelBuildOutput{Path: filepath.Join(directory, output)}, nil
+		}
+	}
+
+	return BazelBuildOutput{}, fmt.Errorf("Expected bazel target '%s' to produce OCI layout or image tarball (.tar), but found: %s",
+		opts.Target, strings.Join(outputs, ", "))
+}
+
+func (b *Bazel) outputFiles(ctx context.Context, directory string,
+	opts config.SourceBazelBuildOpts, prefixedLogger *ctllog.PrefixWriter) ([]string, error) {
+
+	// cquery respects configuration (e.g. --platforms) used during build
+	cmdArgs := []string{"cquery", "--output=files", opts.Target}
+
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	stdout, err := b.run(ctx, directory, cmdArgs, prefixedLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			outputs = append(outputs, line)
+		}
+	}
+	return outputs, nil
+}
+
+func (b *Bazel) run(ctx context.Context, directory string,
+	cmdArgs []string, prefixedLogger *ctllog.PrefixWriter) (string, error) {
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "bazel", cmdArgs...)
+	cmd.Dir = directory
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+
+	err := cmd.Run()
+	prefixedLogger.Flush()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return "", err
+	}
+
+	return stdoutBuf.String(), nil
 }
@@ -0,0 +1,76 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctlbbz "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/bazel"
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+// fakeBazel prints given outputs for cquery (and nothing for build)
+func fakeBazel(t *testing.T, outputs string) {
+	script := `#!/bin/sh
+if [ "$1" = "cquery" ]; then
+  printf "` + outputs + `"
+fi
+`
+	testutil.InstallCLI(t, "bazel", script)
+}
+
+func TestBazelBuildFindsOCILayout(t *testing.T) {
+	fakeBazel(t, "bazel-bin/app/image.tar\\nbazel-bin/app/image\\n")
+
+	srcPath := t.TempDir()
+
+	layoutPath := filepath.Join(srcPath, "bazel-bin", "app", "image")
+	err := os.MkdirAll(layoutPath, 0700)
+	if err != nil {
+		t.Fatalf("Creating layout dir: %s", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(layoutPath, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0600)
+	if err != nil {
+		t.Fatalf("Writing oci-layout: %s", err)
+	}
+
+	logger := ctllog.NewLogger(&bytes.Buffer{})
+	bazel := ctlbbz.NewBazel(ctlbdk.NewDocker(logger), logger)
+
+	output, err := bazel.Build(context.Background(), "app", srcPath, ctlconf.SourceBazelBuildOpts{Target: "//app:image"})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	if !output.OCILayout || output.Path != layoutPath {
+		t.Fatalf("Expected OCI layout output at '%s', but was %#v", layoutPath, output)
+	}
+}
+
+func TestBazelBuildFindsTarball(t *testing.T) {
+	fakeBazel(t, "bazel-bin/app/image.tar\\n")
+
+	srcPath := t.TempDir()
+
+	logger := ctllog.NewLogger(&bytes.Buffer{})
+	bazel := ctlbbz.NewBazel(ctlbdk.NewDocker(logger), logger)
+
+	output, err := bazel.Build(context.Background(), "app", srcPath, ctlconf.SourceBazelBuildOpts{Target: "//app:image.tar"})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedPath := filepath.Join(srcPath, "bazel-bin", "app", "image.tar")
+	if output.OCILayout || output.Path != expectedPath {
+		t.Fatalf("Expected tarball output at '%s', but was %#v", expectedPath, output)
+	}
+}
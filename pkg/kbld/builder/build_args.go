@@ -0,0 +1,41 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+)
+
+type buildArgsKey struct{}
+
+// WithBuildArgs attaches build args (e.g. resolved references of
+// dependencies) that builders should pass to Dockerfile based builds
+func WithBuildArgs(ctx context.Context, buildArgs map[string]string) context.Context {
+	return context.WithValue(ctx, buildArgsKey{}, buildArgs)
+}
+
+func BuildArgsFromContext(ctx context.Context) map[string]string {
+	buildArgs, _ := ctx.Value(buildArgsKey{}).(map[string]string)
+	return buildArgs
+}
+
+// MergeBuildArgs returns build args from context with explicitly configured build args taking precedence
+func MergeBuildArgs(ctx context.Context, buildArgs map[string]string) map[string]string {
+	return mergeMaps(BuildArgsFromContext(ctx), buildArgs)
+}
+
+func mergeMaps(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 {
+		return overrides
+	}
+
+	result := map[string]string{}
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range overrides {
+		result[k] = v
+	}
+	return result
+}
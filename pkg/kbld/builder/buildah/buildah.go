@@ -0,0 +1,190 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package buildah
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+)
+
+type Buildah struct {
+	logger ctllog.Logger
+}
+
+func NewBuildah(logger ctllog.Logger) Buildah {
+	return Buildah{logger}
+}
+
+// BuildAndPush builds image into buildah's local storage (rootless friendly)
+// and optionally pushes it; image ID and pushed digest are recorded via
+// --iidfile and --digestfile instead of inspecting images
+func (b Buildah) BuildAndPush(ctx context.Context, image, directory string,
+	imgDst *ctlconf.ImageDestination, opts ctlconf.SourceBuildahBuildOpts, secrets []ctlconf.SourceSecret) (string, error) {
+
+	tb := ctlb.TagBuilder{}
+
+	randPrefix50, err := tb.RandomStr50()
+	if err != nil {
+		return "", fmt.Errorf("Generating tmp image suffix: %s", err)
+	}
+
+	tmpRef := "kbld:" + tb.CheckTagLen128(fmt.Sprintf(
+		"%s-%s",
+		randPrefix50,
+		tb.TrimStr(tb.CleanStr(image), 50),
+	))
+
+	tmpDir, err := ioutil.TempDir("", "kbld-buildah")
+	if err != nil {
+		return "", fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	prefixedLogger := b.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using buildah): %s -> %s\n", directory, tmpRef)))
+	defer prefixedLogger.Write([]byte("finished build (using buildah)\n"))
+
+	iidPath := filepath.Join(tmpDir, "iid")
+
+	cmdArgs := append([]string{"build"}, b.cmdArgs(opts, secrets)...)
+	cmdArgs = append(cmdArgs, "--iidfile", iidPath, "--tag", tmpRef, ".")
+
+	err = b.run(ctx, directory, cmdArgs, prefixedLogger)
+	if err != nil {
+		return "", err
+	}
+
+	imageID, err := b.readFile(iidPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Retag image with its ID to produce exact image ref if nothing has changed
+	stableRef := "kbld:" + tb.CheckTagLen128(fmt.Sprintf(
+		"%s-%s",
+		tb.TrimStr(tb.CleanStr(image), 50),
+		tb.CheckLen(tb.CleanStr(imageID), 72),
+	))
+
+	err = b.run(ctx, directory, []string{"tag", tmpRef, stableRef}, prefixedLogger)
+	if err != nil {
+		return "", err
+	}
+
+	err = b.run(ctx, directory, []string{"rmi", tmpRef}, prefixedLogger)
+	if err != nil {
+		return "", err
+	}
+
+	if imgDst == nil {
+		return stableRef, nil
+	}
+
+	return b.push(ctx, directory, stableRef, imgDst.NewImage, tmpDir, prefixedLogger)
+}
+
+func (b Buildah) push(ctx context.Context, directory, localRef, imageDst, tmpDir string,
+	prefixedLogger *ctllog.PrefixWriter) (string, error) {
+
+	tagRef, err := ctlb.TagBuilder{}.RandomPushTagRef(imageDst)
+	if err != nil {
+		return "", err
+	}
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using buildah): %s -> %s\n", localRef, tagRef.Name())))
+	defer prefixedLogger.Write([]byte("finished push (using buildah)\n"))
+
+	digestPath := filepath.Join(tmpDir, "digest")
+
+	err = b.run(ctx, directory, []string{"push", "--digestfile", digestPath, localRef, "docker://" + tagRef.Name()}, prefixedLogger)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := b.readFile(digestPath)
+	if err != nil {
+		return "", err
+	}
+
+	digestRefStr := imageDst + "@" + digest
+
+	digestRef, err := regname.NewDigest(digestRefStr, regname.WeakValidation)
+	if err != nil {
+		return "", fmt.Errorf("Validating destination digest ref '%s': %s", digestRefStr, err)
+	}
+
+	return digestRef.Name(), nil
+}
+
+func (b Buildah) cmdArgs(opts ctlconf.SourceBuildahBuildOpts, secrets []ctlconf.SourceSecret) []string {
+	var cmdArgs []string
+
+	if opts.Target != nil {
+		cmdArgs = append(cmdArgs, "--target", *opts.Target)
+	}
+	if opts.Pull != nil && *opts.Pull {
+		cmdArgs = append(cmdArgs, "--pull")
+	}
+	if opts.NoCache != nil && *opts.NoCache {
+		cmdArgs = append(cmdArgs, "--no-cache")
+	}
+	if opts.File != nil {
+		// Since buildah command is executed with cwd of directory,
+		// Dockerfile path doesnt need to be joined with it
+		cmdArgs = append(cmdArgs, "--file", *opts.File)
+	}
+	if opts.Platform != nil {
+		cmdArgs = append(cmdArgs, "--platform", *opts.Platform)
+	}
+	cmdArgs = append(cmdArgs, ctlb.SecretArgs(secrets)...)
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--build-arg", opts.BuildArgs)...)
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--label", opts.Labels)...)
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	return cmdArgs
+}
+
+func (b Buildah) run(ctx context.Context, directory string, cmdArgs []string, prefixedLogger *ctllog.PrefixWriter) error {
+	cmd := exec.CommandContext(ctx, "buildah", cmdArgs...)
+	cmd.Dir = directory
+	cmd.Stdout = prefixedLogger
+	cmd.Stderr = prefixedLogger
+
+	err := cmd.Run()
+	prefixedLogger.Flush()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return err
+	}
+
+	return nil
+}
+
+func (b Buildah) readFile(path string) (string, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Reading buildah output file: %s", err)
+	}
+
+	val := strings.TrimSpace(string(bs))
+	if len(val) == 0 {
+		return "", fmt.Errorf("Expected buildah output file '%s' to be non-empty", filepath.Base(path))
+	}
+
+	return val, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package buildah_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	ctlbbh "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/buildah"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+const (
+	testImageID = "sha256:aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986"
+	testDigest  = "sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d"
+)
+
+// fakeBuildah prints its args and writes --iidfile and --digestfile
+func fakeBuildah(t *testing.T) {
+	script := `#!/bin/sh
+echo "args: $@"
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --iidfile) echo "` + testImageID + `" > "$2"; shift ;;
+    --digestfile) echo "` + testDigest + `" > "$2"; shift ;;
+  esac
+  shift
+done
+`
+	testutil.InstallCLI(t, "buildah", script)
+}
+
+func TestBuildahBuildAndPush(t *testing.T) {
+	fakeBuildah(t)
+
+	var buf bytes.Buffer
+	buildah := ctlbbh.NewBuildah(ctllog.NewLogger(&buf))
+
+	opts := ctlconf.SourceBuildahBuildOpts{BuildArgs: map[string]string{"BASE": "registry.io/base"}}
+	imgDst := &ctlconf.ImageDestination{NewImage: "registry.io/app"}
+
+	url, err := buildah.BuildAndPush(context.Background(), "app", t.TempDir(), imgDst, opts, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedURL := "registry.io/app@" + testDigest
+	if url != expectedURL {
+		t.Fatalf("Expected url >>>%s<<< to match >>>%s<<<", url, expectedURL)
+	}
+
+	expectedOuts := []string{
+		"app | args: build --build-arg BASE=registry.io/base --iidfile ",
+		"app | args: tag kbld:",
+		"app | args: push --digestfile ",
+		" kbld:app-sha256-aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986 docker://registry.io/app:kbld-",
+	}
+	for _, expectedOut := range expectedOuts {
+		if !strings.Contains(buf.String(), expectedOut) {
+			t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedOut)
+		}
+	}
+}
+
+func TestBuildahBuildWithoutPush(t *testing.T) {
+	fakeBuildah(t)
+
+	buildah := ctlbbh.NewBuildah(ctllog.NewLogger(&bytes.Buffer{}))
+
+	url, err := buildah.BuildAndPush(context.Background(), "app", t.TempDir(), nil, ctlconf.SourceBuildahBuildOpts{}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedURL := "kbld:app-sha256-aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986"
+	if url != expectedURL {
+		t.Fatalf("Expected url >>>%s<<< to match >>>%s<<<", url, expectedURL)
+	}
+}
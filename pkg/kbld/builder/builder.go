@@ -0,0 +1,57 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+// Builder builds an image from configured source.
+// When image destination is provided, built image is expected
+// to be pushed and its digest reference returned.
+type Builder interface {
+	Build(ctx context.Context, image string, src ctlconf.Source, imgDst *ctlconf.ImageDestination) (BuildResult, error)
+}
+
+type BuildResult struct {
+	// URL is either a digest reference (when pushed) or a local reference
+	URL string
+	// Origins are added to origins collected from source (e.g. git details)
+	Origins []ctlconf.Origin
+}
+
+// Builders keeps track of builders by source type (e.g. docker, pack)
+type Builders struct {
+	builders map[string]Builder
+}
+
+func NewBuilders() *Builders {
+	return &Builders{builders: map[string]Builder{}}
+}
+
+// Add registers builder for source type replacing previously registered builder
+func (b *Builders) Add(sourceType string, builder Builder) {
+	b.builders[sourceType] = builder
+}
+
+func (b *Builders) Find(sourceType string) (Builder, error) {
+	builder, found := b.builders[sourceType]
+	if !found {
+		return nil, fmt.Errorf("Expected to find builder for source type '%s' (known types: %v)", sourceType, b.SourceTypes())
+	}
+	return builder, nil
+}
+
+func (b *Builders) SourceTypes() []string {
+	var result []string
+	for sourceType := range b.builders {
+		result = append(result, sourceType)
+	}
+	sort.Strings(result)
+	return result
+}
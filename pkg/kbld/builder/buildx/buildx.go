@@ -0,0 +1,239 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package buildx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+)
+
+// Buildx builds images via docker buildx which (unlike docker build)
+// is able to produce and push multi-platform image indexes
+type Buildx struct {
+	docker ctlbdk.Docker
+	logger ctllog.Logger
+}
+
+func NewBuildx(docker ctlbdk.Docker, logger ctllog.Logger) Buildx {
+	return Buildx{docker: docker, logger: logger}
+}
+
+type buildxMetadata struct {
+	Digest string `json:"containerimage.digest"`
+}
+
+// BuildAndPush returns digest reference when image destination is provided,
+// otherwise it loads image into Docker daemon and returns local reference
+func (d Buildx) BuildAndPush(ctx context.Context, image, directory string,
+	imgDst *ctlconf.ImageDestination, opts ctlconf.SourceBuildxBuildOpts) (string, error) {
+
+	if imgDst == nil && len(opts.Platforms) > 1 {
+		return "", fmt.Errorf("Expected image destination to be specified when building for multiple platforms " +
+			"(multi-platform images cannot be loaded into Docker daemon)")
+	}
+
+	tagRef, err := d.tagRef(image, imgDst)
+	if err != nil {
+		return "", err
+	}
+
+	metadataDir, err := ioutil.TempDir("", "kbld-buildx")
+	if err != nil {
+		return "", fmt.Errorf("Creating tmp dir for buildx metadata: %s", err)
+	}
+
+	defer os.RemoveAll(metadataDir)
+
+	metadataPath := filepath.Join(metadataDir, "metadata.json")
+
+	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using buildx): %s -> %s\n", directory, tagRef)))
+	defer prefixedLogger.Write([]byte("finished build (using buildx)\n"))
+
+	cmdArgs := append(d.cmdArgs(ctx, opts), "--metadata-file", metadataPath)
+
+	if imgDst != nil {
+		cmdArgs = append(cmdArgs, "--push")
+	} else {
+		cmdArgs = append(cmdArgs, "--load")
+	}
+
+	cmdArgs = append(cmdArgs, "--tag", tagRef, ".")
+
+	err = d.run(ctx, directory, cmdArgs, prefixedLogger)
+	if err != nil {
+		return "", err
+	}
+
+	if imgDst != nil {
+		digest, err := d.metadataDigest(metadataPath)
+		if err != nil {
+			return "", err
+		}
+
+		digestRefStr := imgDst.NewImage + "@" + digest
+
+		digestRef, err := regname.NewDigest(digestRefStr, regname.WeakValidation)
+		if err != nil {
+			return "", fmt.Errorf("Validating destination digest ref '%s': %s", digestRefStr, err)
+		}
+
+		return digestRef.Name(), nil
+	}
+
+	imageID, err := d.docker.ImageID(ctx, tagRef)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
+		return "", err
+	}
+
+	stableTmpRef, err := d.docker.RetagStable(ctx, ctlbdk.NewDockerTmpRef(tagRef), image, imageID, prefixedLogger)
+	if err != nil {
+		return "", err
+	}
+
+	return stableTmpRef.AsString(), nil
+}
+
+// BuildOCITarball exports built image (or image index) as OCI layout tarball
+func (d Buildx) BuildOCITarball(ctx context.Context, image, directory, tarballPath string,
+	opts ctlconf.SourceBuildxBuildOpts) error {
+
+	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using buildx): %s -> %s\n", directory, tarballPath)))
+	defer prefixedLogger.Write([]byte("finished build (using buildx)\n"))
+
+	cmdArgs := append(d.cmdArgs(ctx, opts), "--output", "type=oci,dest="+tarballPath, ".")
+
+	return d.run(ctx, directory, cmdArgs, prefixedLogger)
+}
+
+func (d Buildx) cmdArgs(ctx context.Context, opts ctlconf.SourceBuildxBuildOpts) []string {
+	cmdArgs := []string{"buildx", "build", "--progress=plain"}
+
+	if opts.Builder != nil {
+		cmdArgs = append(cmdArgs, "--builder", *opts.Builder)
+	}
+	if opts.Target != nil {
+		cmdArgs = append(cmdArgs, "--target", *opts.Target)
+	}
+	if len(opts.Platforms) > 0 {
+		cmdArgs = append(cmdArgs, "--platform", strings.Join(opts.Platforms, ","))
+	}
+	if opts.Pull != nil && *opts.Pull {
+		cmdArgs = append(cmdArgs, "--pull")
+	}
+	if opts.NoCache != nil && *opts.NoCache {
+		cmdArgs = append(cmdArgs, "--no-cache")
+	}
+	if opts.File != nil {
+		// Since docker command is executed with cwd of directory,
+		// Dockerfile path doesnt need to be joined with it
+		cmdArgs = append(cmdArgs, "--file", *opts.File)
+	}
+	for _, cacheFrom := range opts.CacheFrom {
+		cmdArgs = append(cmdArgs, "--cache-from", cacheFrom)
+	}
+	for _, cacheTo := range opts.CacheTo {
+		cmdArgs = append(cmdArgs, "--cache-to", cacheTo)
+	}
+	for _, secret := range opts.Secrets {
+		cmdArgs = append(cmdArgs, "--secret", secret)
+	}
+	for _, ssh := range opts.SSH {
+		cmdArgs = append(cmdArgs, "--ssh", ssh)
+	}
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--build-arg", opts.BuildArgs)...)
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--label", ctlb.LabelsFromContext(ctx))...)
+
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	return cmdArgs
+}
+
+func (d Buildx) run(ctx context.Context, directory string,
+	cmdArgs []string, prefixedLogger *ctllog.PrefixWriter) error {
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "docker", cmdArgs...)
+	cmd.Dir = directory
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+
+	err := cmd.Run()
+	prefixedLogger.Flush()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return err
+	}
+
+	return nil
+}
+
+func (d Buildx) metadataDigest(path string) (string, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Reading buildx metadata file: %s", err)
+	}
+
+	var metadata buildxMetadata
+
+	err = json.Unmarshal(bs, &metadata)
+	if err != nil {
+		return "", fmt.Errorf("Unmarshaling buildx metadata file: %s", err)
+	}
+
+	if !strings.HasPrefix(metadata.Digest, "sha256:") {
+		return "", fmt.Errorf("Expected to find image digest in buildx metadata file but did not")
+	}
+
+	return metadata.Digest, nil
+}
+
+func (d Buildx) tagRef(image string, imgDst *ctlconf.ImageDestination) (string, error) {
+	tb := ctlb.TagBuilder{}
+
+	randPrefix50, err := tb.RandomStr50()
+	if err != nil {
+		return "", fmt.Errorf("Generating tmp image suffix: %s", err)
+	}
+
+	tag := tb.CheckTagLen128(fmt.Sprintf(
+		"%s-%s",
+		randPrefix50,
+		tb.TrimStr(tb.CleanStr(image), 50),
+	))
+
+	if imgDst != nil {
+		tagRef := imgDst.NewImage + ":" + tag
+
+		_, err := regname.NewTag(tagRef, regname.WeakValidation)
+		if err != nil {
+			return "", fmt.Errorf("Validating destination tag ref '%s': %s", tagRef, err)
+		}
+
+		return tagRef, nil
+	}
+
+	return "kbld:" + tag, nil
+}
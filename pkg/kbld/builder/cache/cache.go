@@ -0,0 +1,88 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+// Cache keeps track of pushed images by build cache key (see NewKey).
+// Each entry is kept in a separate file so that concurrent builds do not conflict.
+type Cache struct {
+	dir string
+}
+
+type Entry struct {
+	URL     string           `json:"url"`
+	Origins []ctlconf.Origin `json:"origins,omitempty"`
+}
+
+func NewCache(dir string) Cache {
+	return Cache{dir}
+}
+
+func (c Cache) Get(key string) (Entry, bool, error) {
+	bs, err := ioutil.ReadFile(c.entryPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Entry{}, false, nil
+		}
+		return Entry{}, false, fmt.Errorf("Reading build cache entry: %s", err)
+	}
+
+	var entry Entry
+
+	err = json.Unmarshal(bs, &entry)
+	if err != nil {
+		// Treat corrupted entry as missing since it will be overwritten after build
+		return Entry{}, false, nil
+	}
+
+	return entry, true, nil
+}
+
+func (c Cache) Put(key string, entry Entry) error {
+	err := os.MkdirAll(c.dir, 0700)
+	if err != nil {
+		return fmt.Errorf("Creating build cache directory: %s", err)
+	}
+
+	bs, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("Marshaling build cache entry: %s", err)
+	}
+
+	tmpFile, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		return fmt.Errorf("Creating build cache entry: %s", err)
+	}
+
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(bs)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Writing build cache entry: %s", err)
+	}
+
+	// Rename is atomic hence readers never see partially written entry
+	err = os.Rename(tmpFile.Name(), c.entryPath(key))
+	if err != nil {
+		return fmt.Errorf("Saving build cache entry: %s", err)
+	}
+
+	return nil
+}
+
+func (c Cache) entryPath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
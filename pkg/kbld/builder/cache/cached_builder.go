@@ -0,0 +1,87 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+// CachedBuilder skips builds of pushed images when source contents
+// and build options did not change since previous build
+type CachedBuilder struct {
+	builder  ctlb.Builder
+	cache    Cache
+	registry ctlreg.Registry
+	logger   ctllog.Logger
+}
+
+var _ ctlb.Builder = CachedBuilder{}
+
+func NewCachedBuilder(builder ctlb.Builder, cache Cache,
+	registry ctlreg.Registry, logger ctllog.Logger) CachedBuilder {
+
+	return CachedBuilder{builder: builder, cache: cache, registry: registry, logger: logger}
+}
+
+func (b CachedBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	// Locally built images may be removed from Docker daemon at any time
+	// hence only pushed images (that can be verified) are cached
+	if imgDst == nil {
+		return b.builder.Build(ctx, image, src, imgDst)
+	}
+
+	key, err := NewKey(image, src, imgDst, ctlb.LabelsFromContext(ctx), ctlb.BuildArgsFromContext(ctx))
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	prefixedLogger := b.logger.NewPrefixedWriter(image + " | ")
+
+	entry, found, err := b.cache.Get(key)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	if found {
+		if b.exists(ctx, entry.URL) {
+			prefixedLogger.Write([]byte(fmt.Sprintf("skipping build (using build cache): %s\n", entry.URL)))
+			return ctlb.BuildResult{URL: entry.URL, Origins: entry.Origins}, nil
+		}
+		prefixedLogger.Write([]byte(fmt.Sprintf("ignoring build cache entry (image not found): %s\n", entry.URL)))
+	}
+
+	result, err := b.builder.Build(ctx, image, src, imgDst)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	// Only digest references point to immutable images
+	if _, err := regname.NewDigest(result.URL, regname.WeakValidation); err == nil {
+		err := b.cache.Put(key, Entry{URL: result.URL, Origins: result.Origins})
+		if err != nil {
+			return ctlb.BuildResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+func (b CachedBuilder) exists(ctx context.Context, url string) bool {
+	ref, err := regname.NewDigest(url, regname.WeakValidation)
+	if err != nil {
+		return false
+	}
+
+	_, err = b.registry.Generic(ctx, ref)
+	return err == nil
+}
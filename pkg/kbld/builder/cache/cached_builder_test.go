@@ -0,0 +1,105 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbc "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/cache"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+type countingBuilder struct {
+	url    string
+	builds int
+}
+
+func (b *countingBuilder) Build(context.Context, string,
+	ctlconf.Source, *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	b.builds++
+	return ctlb.BuildResult{URL: b.url}, nil
+}
+
+func TestCachedBuilderSkipsBuildOfUnchangedSource(t *testing.T) {
+	host, reg := testutil.NewRegistry(t)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting image digest: %s", err)
+	}
+
+	tagRef, err := regname.NewTag(host+"/app:v1", regname.Insecure)
+	if err != nil {
+		t.Fatalf("Parsing ref: %s", err)
+	}
+
+	srcPath := t.TempDir()
+	writeSrcFile(t, filepath.Join(srcPath, "Dockerfile"), "FROM scratch")
+
+	src := ctlconf.Source{ImageRef: ctlconf.ImageRef{Image: "app"}, Path: srcPath}
+	imgDst := &ctlconf.ImageDestination{ImageRef: ctlconf.ImageRef{Image: "app"}, NewImage: host + "/app"}
+
+	builder := &countingBuilder{url: host + "/app@" + digest.String()}
+	cachedBuilder := ctlbc.NewCachedBuilder(builder, ctlbc.NewCache(t.TempDir()), reg, ctllog.NewLogger(&bytes.Buffer{}))
+
+	build := func() {
+		result, err := cachedBuilder.Build(context.Background(), "app", src, imgDst)
+		if err != nil {
+			t.Fatalf("Expected no error, but was: %s", err)
+		}
+		if result.URL != builder.url {
+			t.Fatalf("Expected url >>>%s<<< to match >>>%s<<<", result.URL, builder.url)
+		}
+	}
+
+	build()
+
+	// Image is not in registry yet hence cache entry cannot be used
+	build()
+
+	if builder.builds != 2 {
+		t.Fatalf("Expected builds to be 2, but was %d", builder.builds)
+	}
+
+	err = reg.WriteImage(context.Background(), tagRef, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	build()
+
+	if builder.builds != 2 {
+		t.Fatalf("Expected build to be skipped, but builds were %d", builder.builds)
+	}
+
+	writeSrcFile(t, filepath.Join(srcPath, "main.go"), "package main")
+
+	build()
+
+	if builder.builds != 3 {
+		t.Fatalf("Expected build after source change, but builds were %d", builder.builds)
+	}
+}
+
+func writeSrcFile(t *testing.T, path, contents string) {
+	err := ioutil.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+}
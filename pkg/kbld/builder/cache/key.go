@@ -0,0 +1,147 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	ctlbin "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/inputs"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/version"
+)
+
+type keyContents struct {
+	Version     string
+	Image       string
+	SourceType  string
+	Source      ctlconf.Source
+	Destination *ctlconf.ImageDestination
+	Labels      map[string]string
+	BuildArgs   map[string]string
+	Files       string
+	// Values referenced by source config (env variables, secrets
+	// and Dockerfile that may live outside of source inputs)
+	EnvBuildArgs map[string]*string
+	Secrets      map[string]string
+	Dockerfile   string
+}
+
+// NewKey hashes source inputs together with build options
+// so that any change that may affect built image results in a new key
+func NewKey(image string, src ctlconf.Source, imgDst *ctlconf.ImageDestination,
+	labels, buildArgs map[string]string) (string, error) {
+
+	srcInputs, err := ctlbin.NewInputs(src)
+	if err != nil {
+		return "", err
+	}
+
+	filesHash, err := srcInputs.Hash()
+	if err != nil {
+		return "", err
+	}
+
+	var dockerfileHash string
+	if dockerfile := src.DockerfilePath(); len(dockerfile) > 0 {
+		dockerfileHash, err = hashOptionalFile(dockerfile)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	secretsHashes, err := hashSecrets(src)
+	if err != nil {
+		return "", err
+	}
+
+	contents := keyContents{
+		Version:     version.Version,
+		Image:       image,
+		SourceType:  src.Type(),
+		Source:      src,
+		Destination: imgDst,
+		Labels:      labels,
+		BuildArgs:   buildArgs,
+		Files:       filesHash,
+
+		EnvBuildArgs: envBuildArgs(src),
+		Secrets:      secretsHashes,
+		Dockerfile:   dockerfileHash,
+	}
+
+	bs, err := json.Marshal(contents)
+	if err != nil {
+		return "", fmt.Errorf("Marshaling build cache key: %s", err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(bs)), nil
+}
+
+func envBuildArgs(src ctlconf.Source) map[string]*string {
+	if src.Docker == nil {
+		return nil
+	}
+
+	result := map[string]*string{}
+
+	for _, arg := range src.Docker.Build.BuildArgs {
+		if arg.ValueFromEnv != nil {
+			if val, found := os.LookupEnv(*arg.ValueFromEnv); found {
+				result[arg.Name] = &val
+			} else {
+				result[arg.Name] = nil
+			}
+		}
+	}
+
+	return result
+}
+
+func hashSecrets(src ctlconf.Source) (map[string]string, error) {
+	result := map[string]string{}
+
+	for _, secret := range src.BuildSecrets() {
+		switch {
+		case secret.Env != nil:
+			val, found := os.LookupEnv(*secret.Env)
+			if found {
+				result[secret.ID] = fmt.Sprintf("%x", sha256.Sum256([]byte(val)))
+			} else {
+				result[secret.ID] = ""
+			}
+
+		case secret.File != nil:
+			path := *secret.File
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(src.ContextPath(), path)
+			}
+			hash, err := hashOptionalFile(path)
+			if err != nil {
+				return nil, err
+			}
+			result[secret.ID] = hash
+		}
+	}
+
+	return result, nil
+}
+
+// hashOptionalFile hashes contents of a file
+// and returns empty string if file does not exist
+func hashOptionalFile(path string) (string, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("Reading build cache key input: %s", err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(bs)), nil
+}
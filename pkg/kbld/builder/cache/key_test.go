@@ -0,0 +1,80 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cache_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	ctlbc "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/cache"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+func TestNewKeyChangesWithReferencedValues(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	srcPath := t.TempDir()
+	outsidePath := t.TempDir()
+
+	writeSrcFile(t, filepath.Join(outsidePath, "Dockerfile"), "FROM scratch")
+	writeSrcFile(t, filepath.Join(srcPath, "token.txt"), "s3cr3t-token")
+
+	t.Setenv("KBLD_TEST_BUILD_ARG", "val1")
+	t.Setenv("KBLD_TEST_SECRET", "s3cr3t-1")
+
+	src := ctlconf.Source{
+		ImageRef: ctlconf.ImageRef{Image: "app"},
+		Path:     srcPath,
+		Secrets: []ctlconf.SourceSecret{
+			{ID: "env", Env: strPtr("KBLD_TEST_SECRET")},
+			{ID: "file", File: strPtr("token.txt")},
+		},
+		Docker: &ctlconf.SourceDockerOpts{
+			Build: ctlconf.SourceDockerBuildOpts{
+				File: strPtr(filepath.Join(outsidePath, "Dockerfile")),
+				BuildArgs: []ctlconf.SourceDockerBuildArg{
+					{Name: "ARG1", ValueFromEnv: strPtr("KBLD_TEST_BUILD_ARG")},
+				},
+			},
+		},
+	}
+
+	newKey := func() string {
+		key, err := ctlbc.NewKey("app", src, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, but was: %s", err)
+		}
+		return key
+	}
+
+	keys := map[string]string{"initial": newKey()}
+
+	if newKey() != keys["initial"] {
+		t.Fatalf("Expected key to stay the same when nothing changed")
+	}
+
+	changes := []struct {
+		Description string
+		Change      func()
+	}{
+		{"build arg env value", func() { t.Setenv("KBLD_TEST_BUILD_ARG", "val2") }},
+		{"secret env value", func() { t.Setenv("KBLD_TEST_SECRET", "s3cr3t-2") }},
+		{"secret file contents", func() { writeSrcFile(t, filepath.Join(srcPath, "token.txt"), "other-token") }},
+		{"Dockerfile outside of source path", func() {
+			writeSrcFile(t, filepath.Join(outsidePath, "Dockerfile"), "FROM busybox")
+		}},
+	}
+
+	for _, c := range changes {
+		c.Change()
+		key := newKey()
+
+		for desc, prevKey := range keys {
+			if key == prevKey {
+				t.Fatalf("%s: Expected key to differ from key for '%s'", c.Description, desc)
+			}
+		}
+		keys[c.Description] = key
+	}
+}
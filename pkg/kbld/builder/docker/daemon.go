@@ -0,0 +1,61 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// DockerDaemon selects (possibly remote) Docker daemon
+// used by commands; local daemon is used by default
+type DockerDaemon struct {
+	Host    *string
+	Context *string
+}
+
+// Env returns environment variables understood by Docker CLI
+// as well as tools that talk to Docker daemon (e.g. pack, bazel)
+func (d DockerDaemon) Env() []string {
+	var env []string
+	if d.Host != nil {
+		env = append(env, "DOCKER_HOST="+*d.Host)
+	}
+	if d.Context != nil {
+		env = append(env, "DOCKER_CONTEXT="+*d.Context)
+	}
+	return env
+}
+
+// AddEnv configures command to use daemon keeping rest of environment
+func (d DockerDaemon) AddEnv(cmd *exec.Cmd) {
+	env := d.Env()
+	if len(env) == 0 {
+		return
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+}
+
+// WithDaemon returns Docker that runs all commands (build, inspect, tag, push)
+// against given daemon so that image IDs and digests come from the same daemon
+func (d Docker) WithDaemon(daemon DockerDaemon) Docker {
+	d.daemon = daemon
+	return d
+}
+
+func (d Docker) command(ctx context.Context, args ...string) *exec.Cmd {
+	if d.daemon.Context != nil {
+		args = append([]string{"--context", *d.daemon.Context}, args...)
+	}
+
+	cmd := exec.CommandContext(ctx, d.cli, args...)
+	if d.daemon.Host != nil {
+		cmd.Env = append(os.Environ(), "DOCKER_HOST="+*d.daemon.Host)
+	}
+	return cmd
+}
@@ -5,20 +5,33 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 
 	regname "github.com/google/go-containerregistry/pkg/name"
 	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
 )
 
+const (
+	DockerCLIDefault = "docker"
+)
+
 type Docker struct {
 	logger ctllog.Logger
+	// cli is Docker compatible CLI (e.g. docker, podman)
+	cli    string
+	daemon DockerDaemon
+	// digestFile indicates that CLI records pushed digest
+	// via --digestfile (e.g. podman) instead of printing it
+	digestFile bool
 }
 
 type DockerBuildOpts struct {
@@ -28,6 +41,13 @@ type DockerBuildOpts struct {
 	NoCache    *bool
 	File       *string
 	Buildkit   *bool
+	Platform   *string
+	Network    *string
+	BuildArgs  []ctlconf.SourceDockerBuildArg
+	Labels     map[string]string
+	CacheFrom  []string
+	Secrets    []ctlconf.SourceSecret
+	SSH        []string
 	RawOptions *[]string
 }
 
@@ -48,10 +68,23 @@ type DockerImageDigest struct {
 func (r DockerImageDigest) AsString() string { return r.val }
 
 func NewDocker(logger ctllog.Logger) Docker {
-	return Docker{logger}
+	return Docker{logger: logger, cli: DockerCLIDefault}
+}
+
+// WithCLI returns Docker that uses a different Docker compatible CLI (e.g. podman)
+func (d Docker) WithCLI(cli string) Docker {
+	d.cli = cli
+	return d
+}
+
+// WithDigestFile returns Docker that records pushed digest via --digestfile
+// (supported by podman but not docker) instead of parsing push output
+func (d Docker) WithDigestFile(digestFile bool) Docker {
+	d.digestFile = digestFile
+	return d
 }
 
-func (d Docker) Build(image, directory string, opts DockerBuildOpts) (DockerTmpRef, error) {
+func (d Docker) Build(ctx context.Context, image, directory string, opts DockerBuildOpts) (DockerTmpRef, error) {
 	err := d.ensureDirectory(directory)
 	if err != nil {
 		return DockerTmpRef{}, err
@@ -70,6 +103,20 @@ func (d Docker) Build(image, directory string, opts DockerBuildOpts) (DockerTmpR
 		tb.TrimStr(tb.CleanStr(image), 50),
 	))}
 
+	buildArgs, err := d.buildArgs(opts.BuildArgs)
+	if err != nil {
+		return DockerTmpRef{}, err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "kbld-docker")
+	if err != nil {
+		return DockerTmpRef{}, fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	iidPath := filepath.Join(tmpDir, "iid")
+
 	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
 
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using Docker): %s -> %s\n", directory, tmpRef.AsString())))
@@ -94,38 +141,101 @@ func (d Docker) Build(image, directory string, opts DockerBuildOpts) (DockerTmpR
 			// Dockerfile path doesnt need to be joined with it
 			cmdArgs = append(cmdArgs, "--file", *opts.File)
 		}
+		if opts.Platform != nil {
+			cmdArgs = append(cmdArgs, "--platform", *opts.Platform)
+		}
+		if opts.Network != nil {
+			cmdArgs = append(cmdArgs, "--network", *opts.Network)
+		}
+		cmdArgs = append(cmdArgs, buildArgs...)
+		cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--label", opts.Labels)...)
+		for _, cacheFrom := range opts.CacheFrom {
+			cmdArgs = append(cmdArgs, "--cache-from", cacheFrom)
+		}
+		cmdArgs = append(cmdArgs, ctlb.SecretArgs(opts.Secrets)...)
+		for _, ssh := range opts.SSH {
+			cmdArgs = append(cmdArgs, "--ssh", ssh)
+		}
 		if opts.RawOptions != nil {
 			cmdArgs = append(cmdArgs, *opts.RawOptions...)
 		}
 
-		cmdArgs = append(cmdArgs, "--tag", tmpRef.AsString(), ".")
+		cmdArgs = append(cmdArgs, "--iidfile", iidPath, "--tag", tmpRef.AsString(), ".")
 
-		cmd := exec.Command("docker", cmdArgs...)
+		cmd := d.command(ctx, cmdArgs...)
 		cmd.Dir = directory
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
-		if opts.Buildkit != nil {
-			cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+		// Secrets and SSH are only supported by BuildKit
+		if opts.Buildkit != nil || len(opts.Secrets) > 0 || len(opts.SSH) > 0 {
+			if cmd.Env == nil {
+				cmd.Env = os.Environ()
+			}
+			cmd.Env = append(cmd.Env, "DOCKER_BUILDKIT=1")
 		}
 
 		err := cmd.Run()
+		prefixedLogger.Flush()
 		if err != nil {
 			prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
 			return DockerTmpRef{}, err
 		}
 	}
 
-	inspectData, err := d.inspect(tmpRef.AsString())
+	// Use image ID recorded by the build itself instead of inspecting tmp ref
+	imageID, err := readIDFile(iidPath)
 	if err != nil {
-		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
+		prefixedLogger.Write([]byte(fmt.Sprintf("iidfile error: %s\n", err)))
 		return DockerTmpRef{}, err
 	}
 
-	return d.RetagStable(tmpRef, image, inspectData.ID, prefixedLogger)
+	return d.RetagStable(ctx, tmpRef, image, imageID, prefixedLogger)
 }
 
-func (d Docker) RetagStable(tmpRef DockerTmpRef, image, imageID string,
+func readIDFile(path string) (string, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Reading image ID file: %s", err)
+	}
+
+	id := strings.TrimSpace(string(bs))
+	if len(id) == 0 {
+		return "", fmt.Errorf("Expected image ID file to be non-empty")
+	}
+
+	return id, nil
+}
+
+func (d Docker) buildArgs(args []ctlconf.SourceDockerBuildArg) ([]string, error) {
+	var result []string
+
+	for _, arg := range args {
+		var val string
+
+		switch {
+		case arg.Value != nil:
+			val = *arg.Value
+
+		case arg.ValueFromEnv != nil:
+			envVal, found := os.LookupEnv(*arg.ValueFromEnv)
+			if !found {
+				return nil, fmt.Errorf("Expected env variable '%s' to be set for build arg '%s'",
+					*arg.ValueFromEnv, arg.Name)
+			}
+			val = envVal
+
+		default:
+			return nil, fmt.Errorf("Expected build arg '%s' to have value", arg.Name)
+		}
+
+		result = append(result, "--build-arg", arg.Name+"="+val)
+	}
+
+	return result, nil
+}
+
+func (d Docker) RetagStable(ctx context.Context, tmpRef DockerTmpRef, image, imageID string,
 	prefixedLogger *ctllog.PrefixWriter) (DockerTmpRef, error) {
 
 	tb := ctlb.TagBuilder{}
@@ -142,11 +252,12 @@ func (d Docker) RetagStable(tmpRef DockerTmpRef, image, imageID string,
 	{
 		var stdoutBuf, stderrBuf bytes.Buffer
 
-		cmd := exec.Command("docker", "tag", tmpRef.AsString(), stableTmpRef.AsString())
+		cmd := d.command(ctx, "tag", tmpRef.AsString(), stableTmpRef.AsString())
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
 		err := cmd.Run()
+		prefixedLogger.Flush()
 		if err != nil {
 			prefixedLogger.Write([]byte(fmt.Sprintf("tag error: %s\n", err)))
 			return DockerTmpRef{}, err
@@ -158,11 +269,12 @@ func (d Docker) RetagStable(tmpRef DockerTmpRef, image, imageID string,
 	if !strings.HasPrefix(tmpRef.AsString(), "sha256:") {
 		var stdoutBuf, stderrBuf bytes.Buffer
 
-		cmd := exec.Command("docker", "rmi", tmpRef.AsString())
+		cmd := d.command(ctx, "rmi", tmpRef.AsString())
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
 		err := cmd.Run()
+		prefixedLogger.Flush()
 		if err != nil {
 			prefixedLogger.Write([]byte(fmt.Sprintf("untag error: %s\n", err)))
 			return DockerTmpRef{}, err
@@ -172,26 +284,20 @@ func (d Docker) RetagStable(tmpRef DockerTmpRef, image, imageID string,
 	return stableTmpRef, nil
 }
 
-func (d Docker) Push(tmpRef DockerTmpRef, imageDst string) (DockerImageDigest, error) {
-	prefixedLogger := d.logger.NewPrefixedWriter(imageDst + " | ")
+func (d Docker) Push(ctx context.Context, image string, tmpRef DockerTmpRef, imageDst string) (DockerImageDigest, error) {
+	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
 
 	tb := ctlb.TagBuilder{}
 
 	// Generate random tag for pushed image.
 	// TODO we are technically polluting registry with new tags.
-	// Unfortunately we do not know digest upfront so cannot use kbld-sha256-... format.
+	// Unfortunately we do not know digest upfront so cannot use kbld-sha256-... format
+	// (images exported via Save can be pushed with such tags by registry client).
 	imageDstTagged, err := regname.NewTag(imageDst, regname.WeakValidation)
 	if err == nil {
-		randSuffix, err := tb.RandomStr50()
-		if err != nil {
-			return DockerImageDigest{}, fmt.Errorf("Generating image dst suffix: %s", err)
-		}
-
-		imageDstTag := fmt.Sprintf("kbld-%s", randSuffix)
-
-		imageDstTagged, err = regname.NewTag(imageDst+":"+imageDstTag, regname.WeakValidation)
+		imageDstTagged, err = tb.RandomPushTagRef(imageDst)
 		if err != nil {
-			return DockerImageDigest{}, fmt.Errorf("Generating image dst tag '%s': %s", imageDst, err)
+			return DockerImageDigest{}, err
 		}
 	}
 
@@ -200,7 +306,11 @@ func (d Docker) Push(tmpRef DockerTmpRef, imageDst string) (DockerImageDigest, e
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using Docker): %s -> %s\n", tmpRef.AsString(), imageDst)))
 	defer prefixedLogger.Write([]byte("finished push (using Docker)\n"))
 
-	prevInspectData, err := d.inspect(tmpRef.AsString())
+	if d.digestFile {
+		return d.pushWithDigestFile(ctx, tmpRef, imageDst, prefixedLogger)
+	}
+
+	prevInspectData, err := d.inspect(ctx, tmpRef.AsString())
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
 		return DockerImageDigest{}, err
@@ -209,11 +319,12 @@ func (d Docker) Push(tmpRef DockerTmpRef, imageDst string) (DockerImageDigest, e
 	{
 		var stdoutBuf, stderrBuf bytes.Buffer
 
-		cmd := exec.Command("docker", "tag", tmpRef.AsString(), imageDst)
+		cmd := d.command(ctx, "tag", tmpRef.AsString(), imageDst)
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
 		err := cmd.Run()
+		prefixedLogger.Flush()
 		if err != nil {
 			prefixedLogger.Write([]byte(fmt.Sprintf("tag error: %s\n", err)))
 			return DockerImageDigest{}, err
@@ -223,18 +334,19 @@ func (d Docker) Push(tmpRef DockerTmpRef, imageDst string) (DockerImageDigest, e
 	{
 		var stdoutBuf, stderrBuf bytes.Buffer
 
-		cmd := exec.Command("docker", "push", imageDst)
+		cmd := d.command(ctx, "push", imageDst)
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
 		err := cmd.Run()
+		prefixedLogger.Flush()
 		if err != nil {
 			prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
 			return DockerImageDigest{}, err
 		}
 	}
 
-	currInspectData, err := d.inspect(imageDst)
+	currInspectData, err := d.inspect(ctx, imageDst)
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
 		return DockerImageDigest{}, err
@@ -251,6 +363,71 @@ func (d Docker) Push(tmpRef DockerTmpRef, imageDst string) (DockerImageDigest, e
 	return d.determineRepoDigest(currInspectData, prefixedLogger)
 }
 
+func (d Docker) pushWithDigestFile(ctx context.Context, tmpRef DockerTmpRef, imageDst string,
+	prefixedLogger *ctllog.PrefixWriter) (DockerImageDigest, error) {
+
+	tmpDir, err := ioutil.TempDir("", "kbld-docker")
+	if err != nil {
+		return DockerImageDigest{}, fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	digestPath := filepath.Join(tmpDir, "digest")
+
+	// Push local image directly to destination (no need to tag it first)
+	// which avoids races with concurrent retagging
+	cmd := d.command(ctx, "push", "--digestfile", digestPath, tmpRef.AsString(), imageDst)
+	cmd.Stdout = prefixedLogger
+	cmd.Stderr = prefixedLogger
+
+	err = cmd.Run()
+	prefixedLogger.Flush()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return DockerImageDigest{}, err
+	}
+
+	digest, err := readIDFile(digestPath)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("digestfile error: %s\n", err)))
+		return DockerImageDigest{}, err
+	}
+
+	return DockerImageDigest{digest}, nil
+}
+
+// Save exports local image as tarball so that it could be pushed
+// without Docker daemon (e.g. with digest derived tag)
+func (d Docker) Save(ctx context.Context, image string, tmpRef DockerTmpRef, path string) error {
+	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting save (using Docker): %s\n", tmpRef.AsString())))
+	defer prefixedLogger.Write([]byte("finished save (using Docker)\n"))
+
+	cmd := d.command(ctx, "save", "--output", path, tmpRef.AsString())
+	cmd.Stdout = prefixedLogger
+	cmd.Stderr = prefixedLogger
+
+	err := cmd.Run()
+	prefixedLogger.Flush()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("save error: %s\n", err)))
+		return err
+	}
+
+	return nil
+}
+
+// ImageID returns ID of a local image (e.g. loaded by other tools)
+func (d Docker) ImageID(ctx context.Context, ref string) (string, error) {
+	inspectData, err := d.inspect(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("Inspecting image '%s': %s", ref, err)
+	}
+	return inspectData.ID, nil
+}
+
 func (d Docker) ensureDirectory(directory string) error {
 	stat, err := os.Stat(directory)
 	if err != nil {
@@ -301,10 +478,10 @@ type dockerInspectData struct {
 	RepoDigests []string
 }
 
-func (d Docker) inspect(ref string) (dockerInspectData, error) {
+func (d Docker) inspect(ctx context.Context, ref string) (dockerInspectData, error) {
 	var stdoutBuf, stderrBuf bytes.Buffer
 
-	cmd := exec.Command("docker", "inspect", ref)
+	cmd := d.command(ctx, "inspect", ref)
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
@@ -0,0 +1,209 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+func TestDockerWithCLIUsesIIDAndDigestFiles(t *testing.T) {
+	imageID := "sha256:aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986"
+	digest := "sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d"
+
+	// Fake podman prints its args and writes --iidfile and --digestfile
+	script := `#!/bin/sh
+echo "args: $@"
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --iidfile) echo "` + imageID + `" > "$2"; shift ;;
+    --digestfile) echo "` + digest + `" > "$2"; shift ;;
+  esac
+  shift
+done
+`
+	cliPath := testutil.WriteCLI(t, "podman", script)
+
+	var buf bytes.Buffer
+	docker := ctlbdk.NewDocker(ctllog.NewLogger(&buf)).WithCLI(cliPath).WithDigestFile(true)
+
+	tmpRef, err := docker.Build(context.Background(), "app", t.TempDir(), ctlbdk.DockerBuildOpts{})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedRef := "kbld:app-sha256-aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986"
+	if tmpRef.AsString() != expectedRef {
+		t.Fatalf("Expected ref >>>%s<<< to match >>>%s<<<", tmpRef.AsString(), expectedRef)
+	}
+
+	pushedDigest, err := docker.Push(context.Background(), "app", tmpRef, "registry.io/app")
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	if pushedDigest.AsString() != digest {
+		t.Fatalf("Expected digest >>>%s<<< to match >>>%s<<<", pushedDigest.AsString(), digest)
+	}
+
+	expectedOut := "app | args: push --digestfile "
+	if !strings.Contains(buf.String(), expectedOut) {
+		t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedOut)
+	}
+}
+
+func TestDockerWithDaemonUsesSameDaemonForAllCommands(t *testing.T) {
+	imageID := "sha256:aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986"
+
+	// Fake docker prints its args and daemon env, and writes --iidfile
+	script := `#!/bin/sh
+echo "args: $@ (host: $DOCKER_HOST)"
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --iidfile) echo "` + imageID + `" > "$2"; shift ;;
+  esac
+  shift
+done
+`
+	cliPath := testutil.WriteCLI(t, "docker", script)
+
+	dockerContext := "amd64"
+	dockerHost := "ssh://builder@amd64-host"
+
+	cases := []struct {
+		Daemon       ctlbdk.DockerDaemon
+		ExpectedOuts []string
+	}{
+		{
+			Daemon: ctlbdk.DockerDaemon{Context: &dockerContext},
+			ExpectedOuts: []string{
+				"app | args: --context amd64 build --iidfile ",
+				"app | args: --context amd64 tag kbld:",
+				"app | args: --context amd64 rmi kbld:",
+			},
+		},
+		{
+			Daemon: ctlbdk.DockerDaemon{Host: &dockerHost},
+			ExpectedOuts: []string{
+				"app | args: build --iidfile ",
+				". (host: ssh://builder@amd64-host)\n",
+				"app | args: tag kbld:",
+				"app | args: rmi kbld:",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		docker := ctlbdk.NewDocker(ctllog.NewLogger(&buf)).WithCLI(cliPath).WithDaemon(c.Daemon)
+
+		_, err := docker.Build(context.Background(), "app", t.TempDir(), ctlbdk.DockerBuildOpts{})
+		if err != nil {
+			t.Fatalf("Expected no error, but was: %s", err)
+		}
+
+		for _, expectedOut := range c.ExpectedOuts {
+			if !strings.Contains(buf.String(), expectedOut) {
+				t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedOut)
+			}
+		}
+		if strings.Contains(buf.String(), "(host: )") && c.Daemon.Host != nil {
+			t.Fatalf("Expected all commands to use docker host, but was >>>%s<<<", buf.String())
+		}
+	}
+}
+
+func TestDockerEnablesBuildkitForSecretsAndSSH(t *testing.T) {
+	imageID := "sha256:aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986"
+
+	// Fake docker prints whether BuildKit is enabled
+	script := `#!/bin/sh
+echo "$1 buildkit: $DOCKER_BUILDKIT"
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --iidfile) echo "` + imageID + `" > "$2"; shift ;;
+  esac
+  shift
+done
+`
+	cliPath := testutil.WriteCLI(t, "docker", script)
+
+	secretPath := filepath.Join(t.TempDir(), "npmrc")
+
+	cases := []struct {
+		Description string
+		Opts        ctlbdk.DockerBuildOpts
+		ExpectedOut string
+	}{
+		{"no secrets or ssh", ctlbdk.DockerBuildOpts{}, "app | build buildkit: \n"},
+		{"secrets", ctlbdk.DockerBuildOpts{Secrets: []ctlconf.SourceSecret{{ID: "npmrc", File: &secretPath}}}, "app | build buildkit: 1\n"},
+		{"ssh", ctlbdk.DockerBuildOpts{SSH: []string{"default"}}, "app | build buildkit: 1\n"},
+	}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		docker := ctlbdk.NewDocker(ctllog.NewLogger(&buf)).WithCLI(cliPath)
+
+		_, err := docker.Build(context.Background(), "app", t.TempDir(), c.Opts)
+		if err != nil {
+			t.Fatalf("%s: Expected no error, but was: %s", c.Description, err)
+		}
+
+		if !strings.Contains(buf.String(), c.ExpectedOut) {
+			t.Fatalf("%s: Expected output >>>%s<<< to include >>>%s<<<", c.Description, buf.String(), c.ExpectedOut)
+		}
+	}
+}
+
+func TestDockerSecretsAreNotLogged(t *testing.T) {
+	imageID := "sha256:aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986"
+
+	// Fake docker prints its args and (misbehaving) secret value
+	script := `#!/bin/sh
+echo "args: $@"
+echo "token: $KBLD_TEST_NPM_TOKEN"
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --iidfile) echo "` + imageID + `" > "$2"; shift ;;
+  esac
+  shift
+done
+`
+	cliPath := testutil.WriteCLI(t, "docker", script)
+
+	t.Setenv("KBLD_TEST_NPM_TOKEN", "s3cr3t-npm-token")
+
+	tokenEnv := "KBLD_TEST_NPM_TOKEN"
+	secrets := []ctlconf.SourceSecret{{ID: "npm", Env: &tokenEnv}}
+
+	var buf bytes.Buffer
+	logger := ctllog.NewLogger(&buf)
+	logger.Redact(ctlb.SecretValues(".", secrets)...)
+
+	docker := ctlbdk.NewDocker(logger).WithCLI(cliPath)
+
+	_, err := docker.Build(context.Background(), "app", t.TempDir(), ctlbdk.DockerBuildOpts{Secrets: secrets})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedOuts := []string{"--secret id=npm,env=KBLD_TEST_NPM_TOKEN", "app | token: <redacted>\n"}
+	for _, expectedOut := range expectedOuts {
+		if !strings.Contains(buf.String(), expectedOut) {
+			t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedOut)
+		}
+	}
+	if strings.Contains(buf.String(), "s3cr3t-npm-token") {
+		t.Fatalf("Expected output to not include secret value, but was >>>%s<<<", buf.String())
+	}
+}
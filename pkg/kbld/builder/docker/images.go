@@ -0,0 +1,102 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DockerLocalRepo is repository used for locally built images
+	DockerLocalRepo = "kbld"
+
+	dockerCreatedAtLayout = "2006-01-02 15:04:05 -0700 MST"
+)
+
+// DockerLocalImage is an image tagged in local kbld repository
+// (either as temporary kbld:rand-... or stable kbld:<image>-sha256-... tag)
+type DockerLocalImage struct {
+	Tag       string
+	ID        string
+	CreatedAt time.Time
+}
+
+func (i DockerLocalImage) Ref() string { return DockerLocalRepo + ":" + i.Tag }
+
+type dockerImagesData struct {
+	Tag       string
+	ID        string
+	CreatedAt string
+}
+
+// LocalImages lists images tagged in local kbld repository
+func (d Docker) LocalImages(ctx context.Context) ([]DockerLocalImage, error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	cmd := d.command(ctx, "images", "--no-trunc", "--format", "{{json .}}", DockerLocalRepo)
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("Listing local images: %s (stderr: %s)", err, stderrBuf.String())
+	}
+
+	var images []DockerLocalImage
+
+	scanner := bufio.NewScanner(&stdoutBuf)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		var data dockerImagesData
+
+		err := json.Unmarshal([]byte(line), &data)
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshaling local image '%s': %s", line, err)
+		}
+
+		// Untagged images are not managed via kbld tags
+		if data.Tag == "<none>" {
+			continue
+		}
+
+		createdAt, err := time.Parse(dockerCreatedAtLayout, data.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing creation time of local image '%s': %s", data.Tag, err)
+		}
+
+		images = append(images, DockerLocalImage{Tag: data.Tag, ID: data.ID, CreatedAt: createdAt})
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("Reading local images: %s", err)
+	}
+
+	return images, nil
+}
+
+// RemoveImage removes local image reference (only untags image if it has other tags)
+func (d Docker) RemoveImage(ctx context.Context, ref string) error {
+	var stderrBuf bytes.Buffer
+
+	cmd := d.command(ctx, "rmi", ref)
+	cmd.Stderr = &stderrBuf
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Removing local image '%s': %s (stderr: %s)", ref, err, stderrBuf.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/vmware-tanzu/carvel-imgpkg/pkg/imgpkg/lockconfig"
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+)
+
+// Exec runs user specified command to build an image
+type Exec struct {
+	docker ctlbdk.Docker
+	logger ctllog.Logger
+}
+
+// ExecResult holds exactly one of built image locations
+type ExecResult struct {
+	// Local Docker image
+	DockerTmpRef *ctlbdk.DockerTmpRef
+	// Image pushed by the command
+	DigestRef *regname.Digest
+	// OCI image layout on disk that needs to be pushed
+	OCILayoutPath string
+}
+
+func NewExec(docker ctlbdk.Docker, logger ctllog.Logger) Exec {
+	return Exec{docker: docker, logger: logger}
+}
+
+func (e Exec) Build(ctx context.Context, image, directory, imageDst string,
+	opts ctlconf.SourceExecBuildOpts) (ExecResult, error) {
+
+	prefixedLogger := e.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using exec): %s\n", directory)))
+	defer prefixedLogger.Write([]byte("finished build (using exec)\n"))
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, opts.Command, opts.Args...)
+	cmd.Dir = directory
+	cmd.Env = append(os.Environ(), e.env(image, imageDst, opts.Env)...)
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+
+	err := cmd.Run()
+	prefixedLogger.Flush()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return ExecResult{}, err
+	}
+
+	result := opts.Result
+
+	switch {
+	case result.StdoutImageIDRegexp != nil:
+		matches := regexp.MustCompile(*result.StdoutImageIDRegexp).FindStringSubmatch(stdoutBuf.String())
+		if len(matches) != 2 {
+			return ExecResult{}, fmt.Errorf("Expected to find image ID in command output but did not")
+		}
+		return e.dockerResult(ctx, image, matches[1], prefixedLogger)
+
+	case result.ImagesLockPath != nil:
+		return e.imagesLockResult(filepath.Join(directory, *result.ImagesLockPath), imageDst)
+
+	case result.OCILayoutPath != nil:
+		return ExecResult{OCILayoutPath: filepath.Join(directory, *result.OCILayoutPath)}, nil
+
+	case result.ImageRefPath != nil:
+		return e.imageRefResult(ctx, image, filepath.Join(directory, *result.ImageRefPath), imageDst, prefixedLogger)
+
+	default:
+		return ExecResult{}, fmt.Errorf("Expected result to be specified, but was not")
+	}
+}
+
+func (e Exec) env(image, imageDst string, env map[string]string) []string {
+	var result []string
+	for k, v := range env {
+		result = append(result, k+"="+v)
+	}
+	// Sort to keep environment stable across runs
+	sort.Strings(result)
+
+	// Let command know which image is expected and where to push it (if necessary)
+	result = append(result, "KBLD_IMAGE="+image)
+	if len(imageDst) > 0 {
+		result = append(result, "KBLD_IMAGE_DESTINATION="+imageDst)
+	}
+	return result
+}
+
+func (e Exec) dockerResult(ctx context.Context, image, imageID string,
+	prefixedLogger *ctllog.PrefixWriter) (ExecResult, error) {
+
+	if !strings.HasPrefix(imageID, "sha256:") {
+		imageID = "sha256:" + imageID
+	}
+
+	tmpRef, err := e.docker.RetagStable(ctx, ctlbdk.NewDockerTmpRef(imageID), image, imageID, prefixedLogger)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	return ExecResult{DockerTmpRef: &tmpRef}, nil
+}
+
+func (e Exec) imagesLockResult(path, imageDst string) (ExecResult, error) {
+	imagesLock, err := lockconfig.NewImagesLockFromPath(path)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("Reading images lock: %s", err)
+	}
+
+	if len(imagesLock.Images) != 1 {
+		return ExecResult{}, fmt.Errorf("Expected images lock '%s' to contain exactly one image, but found %d",
+			path, len(imagesLock.Images))
+	}
+
+	digestRef, err := regname.NewDigest(imagesLock.Images[0].Image)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("Parsing images lock image as digest reference: %s", err)
+	}
+
+	return e.digestRefResult(digestRef, imageDst)
+}
+
+func (e Exec) imageRefResult(ctx context.Context, image, path, imageDst string,
+	prefixedLogger *ctllog.PrefixWriter) (ExecResult, error) {
+
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("Reading image reference file: %s", err)
+	}
+
+	ref := strings.TrimSpace(string(bs))
+	if len(ref) == 0 {
+		return ExecResult{}, fmt.Errorf("Expected image reference file '%s' to be non-empty", path)
+	}
+
+	digestRef, err := regname.NewDigest(ref)
+	if err == nil {
+		return e.digestRefResult(digestRef, imageDst)
+	}
+
+	// Otherwise reference points to an image in local Docker daemon
+	imageID, err := e.docker.ImageID(ctx, ref)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	return e.dockerResult(ctx, image, imageID, prefixedLogger)
+}
+
+// digestRefResult makes sure that image pushed by the command
+// ended up in destination repository (if one was specified)
+func (e Exec) digestRefResult(digestRef regname.Digest, imageDst string) (ExecResult, error) {
+	if len(imageDst) > 0 {
+		dstRef, err := regname.ParseReference(imageDst, regname.WeakValidation)
+		if err != nil {
+			return ExecResult{}, fmt.Errorf("Parsing image destination: %s", err)
+		}
+
+		if digestRef.Context().Name() != dstRef.Context().Name() {
+			return ExecResult{}, fmt.Errorf("Expected pushed image '%s' to be in destination repository '%s'",
+				digestRef.Name(), dstRef.Context().Name())
+		}
+	}
+
+	return ExecResult{DigestRef: &digestRef}, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlbex "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/exec"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+)
+
+const testDigestRef = "registry.io/app@sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d"
+
+func TestExecImageRefFileWithDigestRef(t *testing.T) {
+	var buf bytes.Buffer
+	logger := ctllog.NewLogger(&buf)
+	exec := ctlbex.NewExec(ctlbdk.NewDocker(logger), logger)
+
+	refPath := "ref"
+	opts := ctlconf.SourceExecBuildOpts{
+		Command: "sh",
+		Args:    []string{"-c", `echo "building $KBLD_IMAGE for $KBLD_IMAGE_DESTINATION with $MODE"; echo "$REF" > ref`},
+		Env:     map[string]string{"MODE": "prod", "REF": testDigestRef},
+		Result:  ctlconf.SourceExecResultOpts{ImageRefPath: &refPath},
+	}
+
+	result, err := exec.Build(context.Background(), "app", t.TempDir(), "registry.io/app", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	if result.DigestRef == nil || result.DigestRef.Name() != testDigestRef {
+		t.Fatalf("Expected digest ref to be found, but was %#v", result)
+	}
+
+	expectedOut := "app | building app for registry.io/app with prod\n"
+	if !strings.Contains(buf.String(), expectedOut) {
+		t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedOut)
+	}
+}
+
+func TestExecImagesLock(t *testing.T) {
+	logger := ctllog.NewLogger(&bytes.Buffer{})
+	exec := ctlbex.NewExec(ctlbdk.NewDocker(logger), logger)
+
+	lockPath := "images.yml"
+	opts := ctlconf.SourceExecBuildOpts{
+		Command: "sh",
+		Args: []string{"-c", `cat > images.yml <<EOF
+apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+images:
+- image: ` + testDigestRef + `
+EOF`},
+		Result: ctlconf.SourceExecResultOpts{ImagesLockPath: &lockPath},
+	}
+
+	result, err := exec.Build(context.Background(), "app", t.TempDir(), "", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	if result.DigestRef == nil || result.DigestRef.Name() != testDigestRef {
+		t.Fatalf("Expected digest ref to be found, but was %#v", result)
+	}
+}
+
+func TestExecImageRefFileWithDigestRefOutsideDestination(t *testing.T) {
+	logger := ctllog.NewLogger(&bytes.Buffer{})
+	exec := ctlbex.NewExec(ctlbdk.NewDocker(logger), logger)
+
+	refPath := "ref"
+	opts := ctlconf.SourceExecBuildOpts{
+		Command: "sh",
+		Args:    []string{"-c", `echo "$REF" > ref`},
+		Env:     map[string]string{"REF": testDigestRef},
+		Result:  ctlconf.SourceExecResultOpts{ImageRefPath: &refPath},
+	}
+
+	_, err := exec.Build(context.Background(), "app", t.TempDir(), "registry.io/other", opts)
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected pushed image '" + testDigestRef + "' to be in destination repository 'registry.io/other'"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+}
+
+func TestExecStdoutImageIDRegexpWithoutMatch(t *testing.T) {
+	logger := ctllog.NewLogger(&bytes.Buffer{})
+	exec := ctlbex.NewExec(ctlbdk.NewDocker(logger), logger)
+
+	regexp := "Image ID: (sha256:[0-9a-f]+)"
+	opts := ctlconf.SourceExecBuildOpts{
+		Command: "echo",
+		Args:    []string{"nothing built"},
+		Result:  ctlconf.SourceExecResultOpts{StdoutImageIDRegexp: &regexp},
+	}
+
+	_, err := exec.Build(context.Background(), "app", t.TempDir(), "", opts)
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected to find image ID in command output but did not"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package inputs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// IgnoreMatcher matches slash separated relative paths against
+// .dockerignore/.gitignore style patterns (last matching pattern wins)
+type IgnoreMatcher struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	regexp  *regexp.Regexp
+	negated bool
+	// dir (slash separated, relative) limits pattern to paths within it
+	dir string
+}
+
+// NewIgnoreMatcher builds matcher from patterns. When anyDepth is set,
+// patterns without a slash match at any depth (as in .gitignore).
+func NewIgnoreMatcher(patterns []string, anyDepth bool) (IgnoreMatcher, error) {
+	var result IgnoreMatcher
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if len(pattern) == 0 || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		var negated bool
+		if strings.HasPrefix(pattern, "!") {
+			negated = true
+			pattern = pattern[1:]
+		}
+
+		pattern = strings.TrimSuffix(pattern, "/")
+
+		if anyDepth && !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+
+		pattern = path.Clean(strings.TrimPrefix(pattern, "/"))
+
+		re, err := regexp.Compile(ignorePatternRegexp(pattern))
+		if err != nil {
+			return IgnoreMatcher{}, fmt.Errorf("Compiling ignore pattern '%s': %s", pattern, err)
+		}
+
+		result.patterns = append(result.patterns, ignorePattern{regexp: re, negated: negated})
+	}
+
+	return result, nil
+}
+
+// NewIgnoreMatcherFromFile reads patterns from file; missing file results in empty matcher
+func NewIgnoreMatcherFromFile(filePath string, anyDepth bool) (IgnoreMatcher, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return IgnoreMatcher{}, nil
+		}
+		return IgnoreMatcher{}, fmt.Errorf("Opening ignore file: %s", err)
+	}
+
+	defer file.Close()
+
+	var patterns []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return IgnoreMatcher{}, fmt.Errorf("Reading ignore file '%s': %s", filePath, err)
+	}
+
+	return NewIgnoreMatcher(patterns, anyDepth)
+}
+
+// Add returns matcher that consults patterns of both matchers
+func (m IgnoreMatcher) Add(other IgnoreMatcher) IgnoreMatcher {
+	var patterns []ignorePattern
+	patterns = append(patterns, m.patterns...)
+	patterns = append(patterns, other.patterns...)
+	return IgnoreMatcher{patterns}
+}
+
+// WithinDir returns matcher whose patterns are relative to given
+// slash separated directory and only match paths within it
+func (m IgnoreMatcher) WithinDir(relDir string) IgnoreMatcher {
+	relDir = path.Clean(relDir)
+	if relDir == "." {
+		return m
+	}
+
+	var patterns []ignorePattern
+	for _, pattern := range m.patterns {
+		pattern.dir = path.Join(relDir, pattern.dir)
+		patterns = append(patterns, pattern)
+	}
+	return IgnoreMatcher{patterns}
+}
+
+// Matches returns true if path (or one of its parent directories) is ignored
+func (m IgnoreMatcher) Matches(relPath string) bool {
+	var matched bool
+
+	for _, pattern := range m.patterns {
+		if pattern.matches(relPath) {
+			matched = !pattern.negated
+		}
+	}
+
+	return matched
+}
+
+// HasNegations indicates whether ignored directories may contain included files
+func (m IgnoreMatcher) HasNegations() bool {
+	for _, pattern := range m.patterns {
+		if pattern.negated {
+			return true
+		}
+	}
+	return false
+}
+
+func (p ignorePattern) matches(relPath string) bool {
+	if len(p.dir) > 0 {
+		if !strings.HasPrefix(relPath, p.dir+"/") {
+			return false
+		}
+		relPath = relPath[len(p.dir)+1:]
+	}
+	for {
+		if p.regexp.MatchString(relPath) {
+			return true
+		}
+		parent := path.Dir(relPath)
+		if parent == "." || parent == relPath {
+			return false
+		}
+		relPath = parent
+	}
+}
+
+func ignorePatternRegexp(pattern string) string {
+	var result strings.Builder
+
+	result.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; {
+		case ch == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			// Consume slash so that '**/a' also matches 'a'
+			if i+1 < len(pattern) && pattern[i+1] == '/' {
+				i++
+				result.WriteString("(.*/)?")
+			} else {
+				result.WriteString(".*")
+			}
+		case ch == '*':
+			result.WriteString("[^/]*")
+		case ch == '?':
+			result.WriteString("[^/]")
+		default:
+			result.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	result.WriteString("$")
+
+	return result.String()
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package inputs_test
+
+import (
+	"testing"
+
+	ctlbin "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/inputs"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	cases := []struct {
+		Patterns []string
+		AnyDepth bool
+		Path     string
+		Expected bool
+	}{
+		{[]string{"*.log"}, false, "app.log", true},
+		{[]string{"*.log"}, false, "logs/app.log", false},
+		{[]string{"*.log"}, true, "logs/app.log", true},
+		{[]string{"**/*.log"}, false, "logs/app.log", true},
+		{[]string{"**/*.log"}, false, "app.log", true},
+		{[]string{"node_modules"}, false, "node_modules/pkg/index.js", true},
+		{[]string{"/build/"}, false, "build/out", true},
+		{[]string{"docs/*.md"}, false, "docs/sub/a.md", false},
+		{[]string{"*.md", "!README.md"}, false, "README.md", false},
+		{[]string{"*.md", "!README.md"}, false, "CHANGELOG.md", true},
+		{[]string{"# comment", ""}, false, "# comment", false},
+		{[]string{"file?.txt"}, false, "file1.txt", true},
+	}
+
+	for _, c := range cases {
+		matcher, err := ctlbin.NewIgnoreMatcher(c.Patterns, c.AnyDepth)
+		if err != nil {
+			t.Fatalf("Expected no error, but was: %s", err)
+		}
+
+		if matcher.Matches(c.Path) != c.Expected {
+			t.Fatalf("Expected patterns %v (any depth %t) matching '%s' to be %t",
+				c.Patterns, c.AnyDepth, c.Path, c.Expected)
+		}
+	}
+}
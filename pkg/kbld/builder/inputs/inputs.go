@@ -0,0 +1,255 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package inputs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+// Inputs determines which files within source directory affect built image
+type Inputs struct {
+	dir        string
+	watchPaths []string
+	ignored    IgnoreMatcher
+	include    *IgnoreMatcher
+	exclude    IgnoreMatcher
+}
+
+func NewInputs(src ctlconf.Source) (Inputs, error) {
+	ignored, err := srcIgnoreMatcher(src)
+	if err != nil {
+		return Inputs{}, err
+	}
+
+	inputs := Inputs{dir: src.Path, ignored: ignored}
+
+	for _, watchPath := range src.WatchPaths {
+		inputs.watchPaths = append(inputs.watchPaths, path.Clean(filepath.ToSlash(watchPath)))
+	}
+
+	if len(src.Include) > 0 {
+		include, err := NewIgnoreMatcher(src.Include, false)
+		if err != nil {
+			return Inputs{}, err
+		}
+		inputs.include = &include
+	}
+
+	inputs.exclude, err = NewIgnoreMatcher(src.Exclude, false)
+	if err != nil {
+		return Inputs{}, err
+	}
+
+	return inputs, nil
+}
+
+// WatchPaths returns paths relative to source directory that contain inputs
+func (i Inputs) WatchPaths() []string {
+	if len(i.watchPaths) == 0 {
+		return []string{"."}
+	}
+	return i.watchPaths
+}
+
+// Matches returns true if slash separated path (relative to source directory) is an input
+func (i Inputs) Matches(relPath string) bool {
+	relPath = path.Clean(relPath)
+
+	if !i.withinWatchPaths(relPath) || i.ignored.Matches(relPath) || i.exclude.Matches(relPath) {
+		return false
+	}
+	if i.include != nil {
+		return i.include.Matches(relPath)
+	}
+	return true
+}
+
+// Files returns sorted slash separated paths (relative to source directory) of all inputs
+func (i Inputs) Files() ([]string, error) {
+	var result []string
+
+	for _, watchPath := range i.WatchPaths() {
+		root := filepath.Join(i.dir, filepath.FromSlash(watchPath))
+
+		err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				// Watch paths may refer to files that do not exist yet
+				if os.IsNotExist(err) && filePath == root {
+					return nil
+				}
+				return err
+			}
+
+			relPath, err := filepath.Rel(i.dir, filePath)
+			if err != nil {
+				return err
+			}
+
+			relPath = filepath.ToSlash(relPath)
+
+			if info.IsDir() {
+				if relPath != "." && i.skipDir(relPath) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if i.Matches(relPath) {
+				result = append(result, relPath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Walking source directory '%s': %s", root, err)
+		}
+	}
+
+	sort.Strings(result)
+
+	return i.unique(result), nil
+}
+
+// Hash hashes paths, modes and contents of all inputs
+func (i Inputs) Hash() (string, error) {
+	files, err := i.Files()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+
+	for _, relPath := range files {
+		err := hashFile(hash, i.dir, relPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// HashDir hashes all files within directory excluding
+// files ignored via .dockerignore or .gitignore at its root
+func HashDir(dirPath string) (string, error) {
+	inputs, err := NewInputs(ctlconf.Source{Path: dirPath})
+	if err != nil {
+		return "", err
+	}
+	return inputs.Hash()
+}
+
+func (i Inputs) withinWatchPaths(relPath string) bool {
+	for _, watchPath := range i.WatchPaths() {
+		if watchPath == "." || relPath == watchPath ||
+			(len(relPath) > len(watchPath) && relPath[:len(watchPath)+1] == watchPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (i Inputs) skipDir(relPath string) bool {
+	// Ignored directories may still contain included files when negations are used
+	if i.ignored.Matches(relPath) && !i.ignored.HasNegations() {
+		return true
+	}
+	if i.exclude.Matches(relPath) && !i.exclude.HasNegations() {
+		return true
+	}
+	return false
+}
+
+func (i Inputs) unique(paths []string) []string {
+	var result []string
+	for idx, p := range paths {
+		if idx == 0 || paths[idx-1] != p {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func srcIgnoreMatcher(src ctlconf.Source) (IgnoreMatcher, error) {
+	// .dockerignore is read from build context and only applies within it
+	contextDir, err := filepath.Rel(src.Path, src.ContextPath())
+	if err != nil {
+		return IgnoreMatcher{}, fmt.Errorf("Calculating context path relative to source path: %s", err)
+	}
+
+	contextDir = filepath.ToSlash(contextDir)
+	if contextDir == ".." || strings.HasPrefix(contextDir, "../") {
+		return IgnoreMatcher{}, fmt.Errorf("Expected context '%s' to be within source path '%s'", src.ContextPath(), src.Path)
+	}
+
+	matcher, err := gitIgnoreMatcher(src.Path)
+	if err != nil {
+		return IgnoreMatcher{}, err
+	}
+
+	dockerMatcher, err := NewIgnoreMatcherFromFile(filepath.Join(src.ContextPath(), ".dockerignore"), false)
+	if err != nil {
+		return IgnoreMatcher{}, err
+	}
+
+	return matcher.Add(dockerMatcher.WithinDir(contextDir)), nil
+}
+
+func gitIgnoreMatcher(dirPath string) (IgnoreMatcher, error) {
+	// .git directory never affects built image contents
+	matcher, err := NewIgnoreMatcher([]string{".git"}, false)
+	if err != nil {
+		return IgnoreMatcher{}, err
+	}
+
+	gitMatcher, err := NewIgnoreMatcherFromFile(filepath.Join(dirPath, ".gitignore"), true)
+	if err != nil {
+		return IgnoreMatcher{}, err
+	}
+
+	return matcher.Add(gitMatcher), nil
+}
+
+func hashFile(hash io.Writer, dirPath, relPath string) error {
+	filePath := filepath.Join(dirPath, filepath.FromSlash(relPath))
+
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return fmt.Errorf("Checking file '%s': %s", filePath, err)
+	}
+
+	fmt.Fprintf(hash, "%s\x00%o\x00", relPath, info.Mode())
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return fmt.Errorf("Reading symlink '%s': %s", filePath, err)
+		}
+		fmt.Fprintf(hash, "%s\x00", target)
+		return nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("Opening file '%s': %s", filePath, err)
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("Reading file '%s': %s", filePath, err)
+	}
+
+	_, err = hash.Write([]byte{0})
+	return err
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package inputs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ctlbin "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/inputs"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+func TestHashDirRespectsIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, dir, "Dockerfile", "FROM scratch")
+	writeFile(t, dir, ".dockerignore", "tmp\n")
+	writeFile(t, dir, ".gitignore", "*.log\n")
+
+	origHash := hashDir(t, dir)
+
+	// Ignored files do not affect hash
+	writeFile(t, dir, "tmp/scratch.txt", "scratch")
+	writeFile(t, dir, "logs/build.log", "log")
+	writeFile(t, dir, ".git/HEAD", "ref: refs/heads/main")
+
+	if hash := hashDir(t, dir); hash != origHash {
+		t.Fatalf("Expected hash to stay the same after adding ignored files")
+	}
+
+	writeFile(t, dir, "main.go", "package main")
+
+	if hash := hashDir(t, dir); hash == origHash {
+		t.Fatalf("Expected hash to change after adding file")
+	}
+}
+
+func TestInputsWatchPathsIncludeExclude(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, dir, "Dockerfile", "FROM scratch")
+	writeFile(t, dir, "services/app/main.go", "package main")
+	writeFile(t, dir, "services/app/main_test.go", "package main")
+	writeFile(t, dir, "services/app/README.md", "app")
+	writeFile(t, dir, "services/other/main.go", "package main")
+	writeFile(t, dir, "libs/shared/lib.go", "package shared")
+
+	src := ctlconf.Source{
+		Path:       dir,
+		WatchPaths: []string{"Dockerfile", "services/app", "libs/shared", "libs/missing"},
+		Include:    []string{"Dockerfile", "**/*.go"},
+		Exclude:    []string{"**/*_test.go"},
+	}
+
+	srcInputs, err := ctlbin.NewInputs(src)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	files, err := srcInputs.Files()
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedFiles := []string{"Dockerfile", "libs/shared/lib.go", "services/app/main.go"}
+
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected files %v to match %v", files, expectedFiles)
+	}
+
+	if srcInputs.Matches("services/other/main.go") {
+		t.Fatalf("Expected file outside of watch paths to not match")
+	}
+}
+
+func TestInputsReadDockerignoreFromContext(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, dir, ".dockerignore", "services\n")
+	writeFile(t, dir, "services/app/.dockerignore", "tmp\n")
+	writeFile(t, dir, "services/app/Dockerfile", "FROM scratch")
+	writeFile(t, dir, "services/app/tmp/scratch.txt", "scratch")
+	writeFile(t, dir, "tmp/shared.txt", "shared")
+
+	srcInputs, err := ctlbin.NewInputs(ctlconf.Source{Path: dir, Context: "services/app"})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	files, err := srcInputs.Files()
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	// .dockerignore at source root is not used since it is not within context
+	expectedFiles := []string{".dockerignore", "services/app/.dockerignore", "services/app/Dockerfile", "tmp/shared.txt"}
+
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Fatalf("Expected files %v to match %v", files, expectedFiles)
+	}
+}
+
+func hashDir(t *testing.T, dir string) string {
+	hash, err := ctlbin.HashDir(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+	return hash
+}
+
+func writeFile(t *testing.T, dir, path, contents string) {
+	path = filepath.Join(dir, path)
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		t.Fatalf("Making dir: %s", err)
+	}
+
+	err = ioutil.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+)
+
+type Kaniko struct {
+	logger ctllog.Logger
+}
+
+func NewKaniko(logger ctllog.Logger) Kaniko {
+	return Kaniko{logger}
+}
+
+// BuildAndPush builds and pushes image without Docker daemon
+// (kaniko executor is expected to run in an unprivileged container)
+func (k Kaniko) BuildAndPush(ctx context.Context, image, directory string,
+	imgDst *ctlconf.ImageDestination, opts ctlconf.SourceKanikoBuildOpts) (string, error) {
+
+	if imgDst == nil {
+		return "", fmt.Errorf("Expected image destination to be configured since kaniko can only push built images")
+	}
+
+	tagRef, err := ctlb.TagBuilder{}.RandomPushTagRef(imgDst.NewImage)
+	if err != nil {
+		return "", err
+	}
+
+	prefixedLogger := k.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using kaniko): %s -> %s\n", directory, tagRef.Name())))
+	defer prefixedLogger.Write([]byte("finished build (using kaniko)\n"))
+
+	tmpDir, err := ioutil.TempDir("", "kbld-kaniko")
+	if err != nil {
+		return "", fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	digestPath := filepath.Join(tmpDir, "digest")
+
+	executor := "executor"
+	if opts.Executor != nil {
+		executor = *opts.Executor
+	}
+
+	absDirectory, err := filepath.Abs(directory)
+	if err != nil {
+		return "", fmt.Errorf("Getting absolute path of '%s': %s", directory, err)
+	}
+
+	cmdArgs := append(k.cmdArgs(absDirectory, opts), "--destination", tagRef.Name(), "--digest-file", digestPath)
+
+	cmd := exec.CommandContext(ctx, executor, cmdArgs...)
+	cmd.Dir = directory
+	cmd.Stdout = prefixedLogger
+	cmd.Stderr = prefixedLogger
+
+	err = cmd.Run()
+	prefixedLogger.Flush()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return "", err
+	}
+
+	digestBs, err := ioutil.ReadFile(digestPath)
+	if err != nil {
+		return "", fmt.Errorf("Reading kaniko digest file: %s", err)
+	}
+
+	digestRefStr := imgDst.NewImage + "@" + strings.TrimSpace(string(digestBs))
+
+	digestRef, err := regname.NewDigest(digestRefStr, regname.WeakValidation)
+	if err != nil {
+		return "", fmt.Errorf("Validating destination digest ref '%s': %s", digestRefStr, err)
+	}
+
+	return digestRef.Name(), nil
+}
+
+func (k Kaniko) cmdArgs(directory string, opts ctlconf.SourceKanikoBuildOpts) []string {
+	file := "Dockerfile"
+	if opts.File != nil {
+		file = *opts.File
+	}
+
+	cmdArgs := []string{"--context", "dir://" + directory, "--dockerfile", filepath.Join(directory, file)}
+	if opts.Target != nil {
+		cmdArgs = append(cmdArgs, "--target", *opts.Target)
+	}
+	if opts.Platform != nil {
+		cmdArgs = append(cmdArgs, "--custom-platform", *opts.Platform)
+	}
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--build-arg", opts.BuildArgs)...)
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--label", opts.Labels)...)
+	if opts.Cache != nil && *opts.Cache {
+		cmdArgs = append(cmdArgs, "--cache=true")
+	}
+	if opts.CacheRepo != nil {
+		cmdArgs = append(cmdArgs, "--cache-repo", *opts.CacheRepo)
+	}
+	if opts.CacheTTL != nil {
+		cmdArgs = append(cmdArgs, "--cache-ttl", *opts.CacheTTL)
+	}
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	return cmdArgs
+}
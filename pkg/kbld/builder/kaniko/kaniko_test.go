@@ -0,0 +1,75 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package kaniko_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlbkn "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/kaniko"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+const testDigest = "sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d"
+
+func TestKanikoBuildAndPush(t *testing.T) {
+	var buf bytes.Buffer
+	kaniko := ctlbkn.NewKaniko(ctllog.NewLogger(&buf))
+
+	// Fake executor prints its args and writes digest file
+	// (passed as last argument) similar to kaniko executor
+	executor := `#!/bin/sh
+echo "args: $@"
+for last; do true; done
+echo "` + testDigest + `" > "$last"
+`
+	executorPath := testutil.WriteCLI(t, "executor", executor)
+
+	cacheRepo := "registry.io/app-cache"
+	cache := true
+
+	opts := ctlconf.SourceKanikoBuildOpts{
+		Executor:  &executorPath,
+		BuildArgs: map[string]string{"BASE": "registry.io/base"},
+		Cache:     &cache,
+		CacheRepo: &cacheRepo,
+	}
+	imgDst := &ctlconf.ImageDestination{NewImage: "registry.io/app"}
+	srcPath := t.TempDir()
+
+	url, err := kaniko.BuildAndPush(context.Background(), "app", srcPath, imgDst, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedURL := "registry.io/app@" + testDigest
+	if url != expectedURL {
+		t.Fatalf("Expected url >>>%s<<< to match >>>%s<<<", url, expectedURL)
+	}
+
+	expectedArgs := "app | args: --context dir://" + srcPath + " --dockerfile " + filepath.Join(srcPath, "Dockerfile") +
+		" --build-arg BASE=registry.io/base --cache=true --cache-repo registry.io/app-cache --destination registry.io/app:"
+	if !strings.Contains(buf.String(), expectedArgs) {
+		t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedArgs)
+	}
+}
+
+func TestKanikoRequiresDestination(t *testing.T) {
+	kaniko := ctlbkn.NewKaniko(ctllog.NewLogger(&bytes.Buffer{}))
+
+	_, err := kaniko.BuildAndPush(context.Background(), "app", t.TempDir(), nil, ctlconf.SourceKanikoBuildOpts{})
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected image destination to be configured since kaniko can only push built images"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+}
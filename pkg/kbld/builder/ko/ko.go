@@ -5,11 +5,17 @@ package ko
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
 	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
 	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
@@ -23,30 +29,122 @@ func NewKo(logger ctllog.Logger) Ko {
 	return Ko{logger: logger}
 }
 
-func (k *Ko) Build(image, directory string, opts config.SourceKoBuildOpts) (ctlbdk.DockerTmpRef, error) {
+func (k *Ko) Build(ctx context.Context, image, directory string, opts config.SourceKoBuildOpts) (ctlbdk.DockerTmpRef, error) {
 	prefixedLogger := k.logger.NewPrefixedWriter(image + " | ")
 
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using ko): %s\n", directory)))
 	defer prefixedLogger.Write([]byte("finished build (using ko)\n"))
 
+	stdout, err := k.run(ctx, directory, []string{"--local"}, nil, opts, prefixedLogger)
+	if err != nil {
+		return ctlbdk.DockerTmpRef{}, err
+	}
+
+	return ctlbdk.NewDockerTmpRef(strings.Trim(stdout, "\n")), nil
+}
+
+// BuildTarball writes built image into tarball without using Docker daemon
+func (k *Ko) BuildTarball(ctx context.Context, image, directory, tarballPath string, opts config.SourceKoBuildOpts) error {
+	prefixedLogger := k.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using ko): %s -> %s\n", directory, tarballPath)))
+	defer prefixedLogger.Write([]byte("finished build (using ko)\n"))
+
+	_, err := k.run(ctx, directory, []string{"--push=false", "--tarball", tarballPath}, nil, opts, prefixedLogger)
+	return err
+}
+
+// BuildAndPush lets ko publish image (or image index for multiple platforms)
+// to image destination and returns pushed digest reference
+func (k *Ko) BuildAndPush(ctx context.Context, image, directory, imageDst string, opts config.SourceKoBuildOpts) (regname.Digest, error) {
+	tagRef, err := ctlb.TagBuilder{}.RandomPushTagRef(imageDst)
+	if err != nil {
+		return regname.Digest{}, err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "kbld-ko")
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	imageRefsPath := filepath.Join(tmpDir, "image-refs")
+
+	prefixedLogger := k.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using ko): %s -> %s\n", directory, imageDst)))
+	defer prefixedLogger.Write([]byte("finished build (using ko)\n"))
+
+	cmdArgs := []string{"--tags", tagRef.TagStr(), "--image-refs", imageRefsPath}
+
+	// Use image destination as is unless other naming was requested
+	if (opts.Bare == nil || !*opts.Bare) && (opts.PreserveImportPaths == nil || !*opts.PreserveImportPaths) {
+		cmdArgs = append(cmdArgs, "--bare")
+	}
+
+	_, err = k.run(ctx, directory, cmdArgs, []string{"KO_DOCKER_REPO=" + imageDst}, opts, prefixedLogger)
+	if err != nil {
+		return regname.Digest{}, err
+	}
+
+	refBs, err := ioutil.ReadFile(imageRefsPath)
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Reading ko image refs file: %s", err)
+	}
+
+	refStr := strings.TrimSpace(string(refBs))
+
+	digestRef, err := regname.NewDigest(refStr, regname.WeakValidation)
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Expected ko to publish digest reference, but was '%s': %s", refStr, err)
+	}
+
+	return digestRef, nil
+}
+
+func (k *Ko) run(ctx context.Context, directory string, extraArgs, extraEnv []string,
+	opts config.SourceKoBuildOpts, prefixedLogger *ctllog.PrefixWriter) (string, error) {
+
 	var stdoutBuf, stderrBuf bytes.Buffer
 
-	cmdArgs := []string{"publish", ".", "--local"}
+	cmdArgs := append([]string{"publish", "."}, extraArgs...)
 
+	if len(opts.Platforms) > 0 {
+		cmdArgs = append(cmdArgs, "--platform", strings.Join(opts.Platforms, ","))
+	}
+	if opts.SBOM != nil {
+		cmdArgs = append(cmdArgs, "--sbom", *opts.SBOM)
+	}
+	if opts.Bare != nil && *opts.Bare {
+		cmdArgs = append(cmdArgs, "--bare")
+	}
+	if opts.PreserveImportPaths != nil && *opts.PreserveImportPaths {
+		cmdArgs = append(cmdArgs, "--preserve-import-paths")
+	}
 	if opts.RawOptions != nil {
 		cmdArgs = append(cmdArgs, *opts.RawOptions...)
 	}
 
-	cmd := exec.Command("ko", cmdArgs...)
+	if opts.BaseImage != nil {
+		extraEnv = append(extraEnv, "KO_DEFAULTBASEIMAGE="+*opts.BaseImage)
+	}
+
+	cmd := exec.CommandContext(ctx, "ko", cmdArgs...)
 	cmd.Dir = directory
 	cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 	cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
+	if len(extraEnv) > 0 {
+		cmd.Env = append(os.Environ(), extraEnv...)
+	}
+
 	err := cmd.Run()
+	prefixedLogger.Flush()
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
-		return ctlbdk.DockerTmpRef{}, err
+		return "", err
 	}
 
-	return ctlbdk.NewDockerTmpRef(strings.Trim(stdoutBuf.String(), "\n")), nil
+	return stdoutBuf.String(), nil
 }
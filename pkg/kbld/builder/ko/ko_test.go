@@ -0,0 +1,66 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package ko_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	ctlbko "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/ko"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+func TestKoBuildAndPush(t *testing.T) {
+	digest := "sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d"
+
+	// Fake ko prints its args and env, and writes --image-refs
+	script := `#!/bin/sh
+echo "args: $@"
+echo "env: $KO_DOCKER_REPO $KO_DEFAULTBASEIMAGE"
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --image-refs) echo "$KO_DOCKER_REPO@` + digest + `" > "$2"; shift ;;
+  esac
+  shift
+done
+`
+	testutil.InstallCLI(t, "ko", script)
+
+	var buf bytes.Buffer
+	ko := ctlbko.NewKo(ctllog.NewLogger(&buf))
+
+	baseImage := "cgr.dev/chainguard/static"
+	sbom := "none"
+
+	opts := ctlconf.SourceKoBuildOpts{
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+		BaseImage: &baseImage,
+		SBOM:      &sbom,
+	}
+
+	digestRef, err := ko.BuildAndPush(context.Background(), "app", t.TempDir(), "registry.io/app", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedRef := "registry.io/app@" + digest
+	if digestRef.Name() != expectedRef {
+		t.Fatalf("Expected ref >>>%s<<< to match >>>%s<<<", digestRef.Name(), expectedRef)
+	}
+
+	expectedOuts := []string{
+		"app | args: publish . --tags kbld-",
+		" --bare --platform linux/amd64,linux/arm64 --sbom none\n",
+		"app | env: registry.io/app cgr.dev/chainguard/static\n",
+	}
+	for _, expectedOut := range expectedOuts {
+		if !strings.Contains(buf.String(), expectedOut) {
+			t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedOut)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os/exec"
@@ -38,8 +39,8 @@ func NewKubectlBuildkit(logger ctllog.Logger) KubectlBuildkit {
 	return KubectlBuildkit{logger}
 }
 
-func (d KubectlBuildkit) BuildAndPush(image, directory string,
-	imgDst *ctlconf.ImageDestination, opts ctlconf.SourceKubectlBuildkitOpts) (string, error) {
+func (d KubectlBuildkit) BuildAndPush(ctx context.Context, image, directory string,
+	imgDst *ctlconf.ImageDestination, opts ctlconf.SourceKubectlBuildkitOpts, secrets []ctlconf.SourceSecret) (string, error) {
 
 	tagRef, err := d.tagRef(image, imgDst)
 	if err != nil {
@@ -72,6 +73,9 @@ func (d KubectlBuildkit) BuildAndPush(image, directory string,
 		// Dockerfile path doesnt need to be joined with it
 		cmdArgs = append(cmdArgs, "--file", *opts.Build.File)
 	}
+	cmdArgs = append(cmdArgs, ctlb.SecretArgs(secrets)...)
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--build-arg", opts.Build.BuildArgs)...)
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--label", ctlb.LabelsFromContext(ctx))...)
 	if opts.Build.RawOptions != nil {
 		cmdArgs = append(cmdArgs, *opts.Build.RawOptions...)
 	}
@@ -84,12 +88,13 @@ func (d KubectlBuildkit) BuildAndPush(image, directory string,
 
 	cmdArgs = append(cmdArgs, "--tag", tagRef, ".")
 
-	cmd := exec.Command("kubectl", cmdArgs...)
+	cmd := exec.CommandContext(ctx, "kubectl", cmdArgs...)
 	cmd.Dir = directory
 	cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 	cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
 	err = cmd.Run()
+	prefixedLogger.Flush()
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
 		return "", err
@@ -121,6 +126,14 @@ func (d KubectlBuildkit) BuildAndPush(image, directory string,
 func (d KubectlBuildkit) tagRef(image string, imgDst *ctlconf.ImageDestination) (string, error) {
 	tb := ctlb.TagBuilder{}
 
+	if imgDst != nil {
+		tagRef, err := tb.RandomPushTagRef(imgDst.NewImage)
+		if err != nil {
+			return "", err
+		}
+		return tagRef.Name(), nil
+	}
+
 	randPrefix50, err := tb.RandomStr50()
 	if err != nil {
 		return "", fmt.Errorf("Generating tmp image suffix: %s", err)
@@ -132,16 +145,5 @@ func (d KubectlBuildkit) tagRef(image string, imgDst *ctlconf.ImageDestination)
 		tb.TrimStr(tb.CleanStr(image), 50),
 	))
 
-	if imgDst != nil {
-		tagRef := imgDst.NewImage + ":" + tag
-
-		_, err := regname.NewTag(tagRef, regname.WeakValidation)
-		if err != nil {
-			return "", fmt.Errorf("Validating destination tag ref '%s': %s", tagRef, err)
-		}
-
-		return tagRef, nil
-	}
-
 	return "kbld:" + tag, nil
 }
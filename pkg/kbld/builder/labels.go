@@ -0,0 +1,51 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+	"sort"
+)
+
+// Pre-defined annotation keys (https://github.com/opencontainers/image-spec/blob/main/annotations.md)
+const (
+	LabelCreated  = "org.opencontainers.image.created"
+	LabelSource   = "org.opencontainers.image.source"
+	LabelVersion  = "org.opencontainers.image.version"
+	LabelRevision = "org.opencontainers.image.revision"
+)
+
+type labelsKey struct{}
+
+// WithLabels attaches labels that builders should add to built images
+// (builders that do not support labels ignore them)
+func WithLabels(ctx context.Context, labels map[string]string) context.Context {
+	return context.WithValue(ctx, labelsKey{}, labels)
+}
+
+func LabelsFromContext(ctx context.Context) map[string]string {
+	labels, _ := ctx.Value(labelsKey{}).(map[string]string)
+	return labels
+}
+
+// MergeLabels returns labels from context with explicitly configured labels taking precedence
+func MergeLabels(ctx context.Context, labels map[string]string) map[string]string {
+	return mergeMaps(LabelsFromContext(ctx), labels)
+}
+
+// KeyValueArgs returns sorted CLI flags (e.g. --label k=v) for key-value pairs
+func KeyValueArgs(flag string, kvs map[string]string) []string {
+	var names []string
+	for name := range kvs {
+		names = append(names, name)
+	}
+	// Sort to keep command stable across runs
+	sort.Strings(names)
+
+	var result []string
+	for _, name := range names {
+		result = append(result, flag, name+"="+kvs[name])
+	}
+	return result
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+// Pusher pushes images built without Docker daemon
+// (e.g. written as OCI image layout or tarball) via registry client
+type Pusher struct {
+	registry ctlreg.Registry
+	logger   ctllog.Logger
+}
+
+func NewPusher(registry ctlreg.Registry, logger ctllog.Logger) Pusher {
+	return Pusher{registry: registry, logger: logger}
+}
+
+// PushLayout pushes single image or image index found in OCI image layout
+func (p Pusher) PushLayout(ctx context.Context, image, path, imageDst string) (regname.Digest, error) {
+	prefixedLogger := p.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using registry): %s -> %s\n", path, imageDst)))
+	defer prefixedLogger.Write([]byte("finished push (using registry)\n"))
+
+	layoutPath, err := layout.FromPath(path)
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Reading OCI layout: %s", err)
+	}
+
+	layoutIdx, err := layoutPath.ImageIndex()
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Reading OCI layout index: %s", err)
+	}
+
+	idxManifest, err := layoutIdx.IndexManifest()
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Reading OCI layout index manifest: %s", err)
+	}
+
+	if len(idxManifest.Manifests) != 1 {
+		return regname.Digest{}, fmt.Errorf("Expected OCI layout '%s' to contain exactly one image or image index, but found %d",
+			path, len(idxManifest.Manifests))
+	}
+
+	desc := idxManifest.Manifests[0]
+
+	uploadTagRef, digestRef, err := p.refs(imageDst, desc.Digest)
+	if err != nil {
+		return regname.Digest{}, err
+	}
+
+	if desc.MediaType.IsIndex() {
+		idx, err := layoutIdx.ImageIndex(desc.Digest)
+		if err != nil {
+			return regname.Digest{}, fmt.Errorf("Reading OCI layout image index: %s", err)
+		}
+
+		err = p.registry.WriteIndex(ctx, uploadTagRef, idx)
+		if err != nil {
+			prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+			return regname.Digest{}, fmt.Errorf("Pushing image index as %s: %s", digestRef.Name(), err)
+		}
+	} else {
+		img, err := layoutIdx.Image(desc.Digest)
+		if err != nil {
+			return regname.Digest{}, fmt.Errorf("Reading OCI layout image: %s", err)
+		}
+
+		err = p.writeImage(ctx, uploadTagRef, digestRef, img, prefixedLogger)
+		if err != nil {
+			return regname.Digest{}, err
+		}
+	}
+
+	return digestRef, nil
+}
+
+// PushLayoutTarball pushes OCI image layout archived as tarball
+// (e.g. produced by buildx with type=oci output)
+func (p Pusher) PushLayoutTarball(ctx context.Context, image, path, imageDst string) (regname.Digest, error) {
+	layoutDir, err := ioutil.TempDir("", "kbld-oci-layout")
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Creating tmp dir for OCI layout: %s", err)
+	}
+
+	defer os.RemoveAll(layoutDir)
+
+	err = p.extractTar(path, layoutDir)
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Extracting OCI layout tarball: %s", err)
+	}
+
+	return p.PushLayout(ctx, image, layoutDir, imageDst)
+}
+
+// PushTarball pushes single image found in tarball produced by `docker save`
+// (also produced by ko and rules_docker)
+func (p Pusher) PushTarball(ctx context.Context, image, path, imageDst string) (regname.Digest, error) {
+	prefixedLogger := p.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using registry): %s -> %s\n", path, imageDst)))
+	defer prefixedLogger.Write([]byte("finished push (using registry)\n"))
+
+	img, err := tarball.ImageFromPath(path, nil)
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Reading image tarball: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Getting image tarball digest: %s", err)
+	}
+
+	uploadTagRef, digestRef, err := p.refs(imageDst, digest)
+	if err != nil {
+		return regname.Digest{}, err
+	}
+
+	err = p.writeImage(ctx, uploadTagRef, digestRef, img, prefixedLogger)
+	if err != nil {
+		return regname.Digest{}, err
+	}
+
+	return digestRef, nil
+}
+
+func (p Pusher) writeImage(ctx context.Context, uploadTagRef regname.Tag, digestRef regname.Digest,
+	img regv1.Image, prefixedLogger *ctllog.PrefixWriter) error {
+
+	err := p.registry.WriteImage(ctx, uploadTagRef, img)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return fmt.Errorf("Pushing image as %s: %s", digestRef.Name(), err)
+	}
+	return nil
+}
+
+func (p Pusher) refs(imageDst string, digest regv1.Hash) (regname.Tag, regname.Digest, error) {
+	repo, err := regname.NewRepository(imageDst, regname.WeakValidation)
+	if err != nil {
+		return regname.Tag{}, regname.Digest{}, fmt.Errorf("Parsing image destination '%s': %s", imageDst, err)
+	}
+
+	// Seems like AWS ECR doesnt like using digests for manifest uploads
+	uploadTagRef, err := regname.NewTag(repo.Name() + ":" + ctlb.TagBuilder{}.DigestTag(digest.String()))
+	if err != nil {
+		return regname.Tag{}, regname.Digest{}, fmt.Errorf("Building upload tag image ref: %s", err)
+	}
+
+	digestRef, err := regname.NewDigest(fmt.Sprintf("%s@%s", repo.Name(), digest))
+	if err != nil {
+		return regname.Tag{}, regname.Digest{}, fmt.Errorf("Building digest image ref: %s", err)
+	}
+
+	return uploadTagRef, digestRef, nil
+}
+
+func (p Pusher) extractTar(path, dstDir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	tarReader := tar.NewReader(file)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		dstDir = filepath.Clean(dstDir)
+		dstPath := filepath.Join(dstDir, header.Name)
+
+		// Avoid writing outside of destination directory
+		if dstPath != dstDir && !strings.HasPrefix(dstPath, dstDir+string(os.PathSeparator)) {
+			return fmt.Errorf("Expected tar entry '%s' to be within archive", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err := os.MkdirAll(dstPath, 0700)
+			if err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			err := p.extractFile(tarReader, dstPath)
+			if err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("Expected tar entry '%s' to be a file or a directory", header.Name)
+		}
+	}
+}
+
+func (p Pusher) extractFile(src io.Reader, dstPath string) error {
+	err := os.MkdirAll(filepath.Dir(dstPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = io.Copy(file, src)
+	return err
+}
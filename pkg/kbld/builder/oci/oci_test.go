@@ -0,0 +1,130 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	ctlboci "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/oci"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+func TestPushLayout(t *testing.T) {
+	host, reg := testutil.NewRegistry(t)
+	img := newRandomImage(t)
+	layoutPath := writeLayout(t, img)
+
+	pusher := ctlboci.NewPusher(reg, ctllog.NewLogger(&bytes.Buffer{}))
+
+	digestRef, err := pusher.PushLayout(context.Background(), "app", layoutPath, host+"/app")
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	assertPushed(t, reg, host, digestRef, img)
+}
+
+func TestPushLayoutTarball(t *testing.T) {
+	host, reg := testutil.NewRegistry(t)
+	img := newRandomImage(t)
+	layoutPath := writeLayout(t, img)
+
+	tarballPath := filepath.Join(t.TempDir(), "image.tar")
+
+	// Archive layout the same way buildx does for type=oci output
+	cmd := exec.Command("tar", "-cf", tarballPath, "-C", layoutPath, ".")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Archiving OCI layout: %s (output: %s)", err, out)
+	}
+
+	pusher := ctlboci.NewPusher(reg, ctllog.NewLogger(&bytes.Buffer{}))
+
+	digestRef, err := pusher.PushLayoutTarball(context.Background(), "app", tarballPath, host+"/app")
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	assertPushed(t, reg, host, digestRef, img)
+}
+
+func TestPushTarball(t *testing.T) {
+	host, reg := testutil.NewRegistry(t)
+	img := newRandomImage(t)
+
+	tarballPath := filepath.Join(t.TempDir(), "image.tar")
+
+	err := tarball.WriteToFile(tarballPath, nil, img)
+	if err != nil {
+		t.Fatalf("Writing image tarball: %s", err)
+	}
+
+	pusher := ctlboci.NewPusher(reg, ctllog.NewLogger(&bytes.Buffer{}))
+
+	digestRef, err := pusher.PushTarball(context.Background(), "app", tarballPath, host+"/app")
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	assertPushed(t, reg, host, digestRef, img)
+}
+
+func newRandomImage(t *testing.T) regv1.Image {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+	return img
+}
+
+func writeLayout(t *testing.T, img regv1.Image) string {
+	layoutPath, err := layout.Write(t.TempDir(), empty.Index)
+	if err != nil {
+		t.Fatalf("Writing OCI layout: %s", err)
+	}
+
+	err = layoutPath.AppendImage(img)
+	if err != nil {
+		t.Fatalf("Appending image to OCI layout: %s", err)
+	}
+
+	return string(layoutPath)
+}
+
+func assertPushed(t *testing.T, reg ctlreg.Registry, host string, digestRef regname.Digest, img regv1.Image) {
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting image digest: %s", err)
+	}
+
+	if digestRef.DigestStr() != imgDigest.String() {
+		t.Fatalf("Expected digest %s to match %s", digestRef.DigestStr(), imgDigest)
+	}
+
+	uploadTagRef, err := regname.NewTag(host+"/app:kbld-sha256-"+imgDigest.Hex, regname.Insecure)
+	if err != nil {
+		t.Fatalf("Parsing ref: %s", err)
+	}
+
+	desc, err := reg.Generic(context.Background(), uploadTagRef)
+	if err != nil {
+		t.Fatalf("Expected pushed image to be found, but was: %s", err)
+	}
+
+	if desc.Digest != imgDigest {
+		t.Fatalf("Expected pushed digest %s to match %s", desc.Digest, imgDigest)
+	}
+}
@@ -5,11 +5,14 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os/exec"
 	"regexp"
 
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
 	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
 	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
 )
@@ -21,10 +24,17 @@ var (
 	// [exporter] *** Image ID: 2be602fbc1ecffdf9cc1c8ccb1f1cd6fb1d0a2e76dccbfcc34898bf35c836beb
 	// Image ID is printed here: https://github.com/buildpack/lifecycle/blob/4e449525af56096f7cf8a521900bf6216467f0d7/save.go#L39
 	packImageID = regexp.MustCompile("Image ID: (sha256:)?([0-9a-z]+)")
+
+	// Example output when publishing:
+	// [exporter] *** Images (sha256:55d863c4231ec285b88516942fd5d636216c36b6a686a20bf28d1aa5125c16b7):
+	// [exporter]       registry.io/myapp:kbld-... - succeeded
+	// [exporter] *** Digest: sha256:55d863c4231ec285b88516942fd5d636216c36b6a686a20bf28d1aa5125c16b7
+	packDigest = regexp.MustCompile(`Digest: (sha256:[0-9a-f]{64})`)
 )
 
 type Pack struct {
 	docker ctlbdk.Docker
+	daemon ctlbdk.DockerDaemon
 	logger ctllog.Logger
 }
 
@@ -32,66 +42,133 @@ type PackBuildOpts struct {
 	Builder    *string
 	Buildpacks *[]string
 	ClearCache *bool
+	Env        map[string]string
+	RunImage   *string
+	CacheImage *string
+	Descriptor *string
 	RawOptions *[]string // pack build -h
 }
 
 func NewPack(docker ctlbdk.Docker, logger ctllog.Logger) Pack {
-	return Pack{docker, logger}
+	return Pack{docker: docker, logger: logger}
+}
+
+// WithDaemon returns Pack that builds (and retags) images using given Docker daemon
+func (d Pack) WithDaemon(daemon ctlbdk.DockerDaemon) Pack {
+	d.docker = d.docker.WithDaemon(daemon)
+	d.daemon = daemon
+	return d
 }
 
-func (d Pack) Build(image, directory string, opts PackBuildOpts) (ctlbdk.DockerTmpRef, error) {
+func (d Pack) Build(ctx context.Context, image, directory string, opts PackBuildOpts) (ctlbdk.DockerTmpRef, error) {
 	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
 
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using pack): %s\n", directory)))
 	defer prefixedLogger.Write([]byte("finished build (using pack)\n"))
 
-	var imageID string
+	stdout, err := d.run(ctx, image, directory, opts, nil, prefixedLogger)
+	if err != nil {
+		return ctlbdk.DockerTmpRef{}, err
+	}
 
-	{
-		var stdoutBuf, stderrBuf bytes.Buffer
+	matches := packImageID.FindStringSubmatch(stdout)
+	if len(matches) != 3 {
+		return ctlbdk.DockerTmpRef{}, fmt.Errorf("Expected to find image ID in pack output but did not")
+	}
 
-		// --verbose is necessary for Image ID to be displayed
-		cmdArgs := []string{"build", "--verbose", image, "--path", "."}
+	imageID := "sha256:" + matches[2]
 
-		if opts.Builder == nil {
-			return ctlbdk.DockerTmpRef{}, fmt.Errorf("Expected builder to be specified, but was not")
-		}
-		cmdArgs = append(cmdArgs, "--builder", *opts.Builder)
+	return d.docker.RetagStable(ctx, ctlbdk.NewDockerTmpRef(imageID), image, imageID, prefixedLogger)
+}
 
-		if opts.Buildpacks != nil {
-			for _, b := range *opts.Buildpacks {
-				cmdArgs = append(cmdArgs, []string{"--buildpack", b}...)
-			}
-		}
-		if opts.ClearCache != nil && *opts.ClearCache {
-			cmdArgs = append(cmdArgs, "--clear-cache")
-		}
-		if opts.RawOptions != nil {
-			cmdArgs = append(cmdArgs, *opts.RawOptions...)
-		}
+// BuildAndPublish builds and pushes image directly from lifecycle
+// avoiding Docker daemon (except for running lifecycle itself)
+func (d Pack) BuildAndPublish(ctx context.Context, image, directory, imageDst string, opts PackBuildOpts) (regname.Digest, error) {
+	tagRef, err := ctlb.TagBuilder{}.RandomPushTagRef(imageDst)
+	if err != nil {
+		return regname.Digest{}, err
+	}
 
-		cmd := exec.Command("pack", cmdArgs...)
-		cmd.Dir = directory
-		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
-		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
 
-		err := cmd.Run()
-		if err != nil {
-			prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
-			return ctlbdk.DockerTmpRef{}, err
-		}
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using pack): %s -> %s\n", directory, tagRef.Name())))
+	defer prefixedLogger.Write([]byte("finished build (using pack)\n"))
 
-		matches := packImageID.FindStringSubmatch(stdoutBuf.String())
-		if len(matches) != 3 {
-			return ctlbdk.DockerTmpRef{}, fmt.Errorf("Expected to find image ID in pack output but did not")
-		}
+	stdout, err := d.run(ctx, tagRef.Name(), directory, opts, []string{"--publish"}, prefixedLogger)
+	if err != nil {
+		return regname.Digest{}, err
+	}
+
+	matches := packDigest.FindStringSubmatch(stdout)
+	if len(matches) != 2 {
+		return regname.Digest{}, fmt.Errorf("Expected to find image digest in pack output but did not")
+	}
+
+	digestRefStr := imageDst + "@" + matches[1]
 
-		imageID = "sha256:" + matches[2]
+	digestRef, err := regname.NewDigest(digestRefStr, regname.WeakValidation)
+	if err != nil {
+		return regname.Digest{}, fmt.Errorf("Validating destination digest ref '%s': %s", digestRefStr, err)
 	}
 
-	return d.docker.RetagStable(ctlbdk.NewDockerTmpRef(imageID), image, imageID, prefixedLogger)
+	return digestRef, nil
 }
 
-func (d Pack) Push(tmpRef ctlbdk.DockerTmpRef, imageDst string) (ctlbdk.DockerImageDigest, error) {
-	return d.docker.Push(tmpRef, imageDst)
+func (d Pack) Push(ctx context.Context, image string, tmpRef ctlbdk.DockerTmpRef, imageDst string) (ctlbdk.DockerImageDigest, error) {
+	return d.docker.Push(ctx, image, tmpRef, imageDst)
+}
+
+func (d Pack) run(ctx context.Context, image, directory string, opts PackBuildOpts,
+	extraArgs []string, prefixedLogger *ctllog.PrefixWriter) (string, error) {
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	// --verbose is necessary for Image ID to be displayed
+	cmdArgs := []string{"build", "--verbose", image, "--path", "."}
+
+	if opts.Builder == nil {
+		return "", fmt.Errorf("Expected builder to be specified, but was not")
+	}
+	cmdArgs = append(cmdArgs, "--builder", *opts.Builder)
+
+	if opts.Buildpacks != nil {
+		for _, b := range *opts.Buildpacks {
+			cmdArgs = append(cmdArgs, []string{"--buildpack", b}...)
+		}
+	}
+	if opts.ClearCache != nil && *opts.ClearCache {
+		cmdArgs = append(cmdArgs, "--clear-cache")
+	}
+	if opts.RunImage != nil {
+		cmdArgs = append(cmdArgs, "--run-image", *opts.RunImage)
+	}
+	if opts.CacheImage != nil {
+		cmdArgs = append(cmdArgs, "--cache-image", *opts.CacheImage)
+	}
+	if opts.Descriptor != nil {
+		// Since pack command is executed with cwd of directory,
+		// descriptor path doesnt need to be joined with it
+		cmdArgs = append(cmdArgs, "--descriptor", *opts.Descriptor)
+	}
+	cmdArgs = append(cmdArgs, ctlb.KeyValueArgs("--env", opts.Env)...)
+	cmdArgs = append(cmdArgs, extraArgs...)
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	cmd := exec.CommandContext(ctx, "pack", cmdArgs...)
+	cmd.Dir = directory
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+
+	d.daemon.AddEnv(cmd)
+
+	err := cmd.Run()
+	prefixedLogger.Flush()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return "", err
+	}
+
+	return stdoutBuf.String(), nil
 }
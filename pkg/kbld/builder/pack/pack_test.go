@@ -0,0 +1,59 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlbpk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/pack"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+func TestPackBuildAndPublish(t *testing.T) {
+	digest := "sha256:55d863c4231ec285b88516942fd5d636216c36b6a686a20bf28d1aa5125c16b7"
+
+	// Fake pack prints its args and digest similar to lifecycle exporter
+	script := `#!/bin/sh
+echo "args: $@"
+echo "[exporter] *** Digest: ` + digest + `"
+`
+	testutil.InstallCLI(t, "pack", script)
+
+	var buf bytes.Buffer
+	logger := ctllog.NewLogger(&buf)
+	pack := ctlbpk.NewPack(ctlbdk.NewDocker(logger), logger)
+
+	builder := "paketobuildpacks/builder:base"
+	runImage := "paketobuildpacks/run:base"
+	cacheImage := "registry.io/app-cache"
+
+	opts := ctlbpk.PackBuildOpts{
+		Builder:    &builder,
+		RunImage:   &runImage,
+		CacheImage: &cacheImage,
+		Env:        map[string]string{"BP_GO_TARGETS": "./cmd/app"},
+	}
+
+	digestRef, err := pack.BuildAndPublish(context.Background(), "app", t.TempDir(), "registry.io/app", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedRef := "registry.io/app@" + digest
+	if digestRef.Name() != expectedRef {
+		t.Fatalf("Expected ref >>>%s<<< to match >>>%s<<<", digestRef.Name(), expectedRef)
+	}
+
+	expectedArgs := " --path . --builder paketobuildpacks/builder:base --run-image paketobuildpacks/run:base " +
+		"--cache-image registry.io/app-cache --env BP_GO_TARGETS=./cmd/app --publish\n"
+	if !strings.Contains(buf.String(), "app | args: build --verbose registry.io/app:kbld-") ||
+		!strings.Contains(buf.String(), expectedArgs) {
+		t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedArgs)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+// SecretSpec returns --secret flag value that refers to secret
+// by env variable name or file path (never by its value)
+func SecretSpec(secret ctlconf.SourceSecret) string {
+	if secret.Env != nil {
+		return fmt.Sprintf("id=%s,env=%s", secret.ID, *secret.Env)
+	}
+	return fmt.Sprintf("id=%s,src=%s", secret.ID, *secret.File)
+}
+
+// SecretArgs returns --secret flags for secrets
+func SecretArgs(secrets []ctlconf.SourceSecret) []string {
+	var result []string
+	for _, secret := range secrets {
+		result = append(result, "--secret", SecretSpec(secret))
+	}
+	return result
+}
+
+// minSecretValueLen avoids redacting trivially short values
+// (e.g. "1" or "yes") which would mangle unrelated output
+const minSecretValueLen = 4
+
+// SecretValues returns secret values (e.g. so that they could be redacted from logs);
+// missing env variables and unreadable files are skipped since builds will report them
+// and values shorter than minSecretValueLen are skipped since they cannot be told apart
+func SecretValues(directory string, secrets []ctlconf.SourceSecret) []string {
+	var result []string
+
+	for _, secret := range secrets {
+		var val string
+
+		switch {
+		case secret.Env != nil:
+			val = os.Getenv(*secret.Env)
+
+		case secret.File != nil:
+			path := *secret.File
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(directory, path)
+			}
+
+			bs, err := ioutil.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			val = string(bs)
+		}
+
+		val = strings.TrimSpace(val)
+		if len(val) < minSecretValueLen {
+			continue
+		}
+
+		result = append(result, val)
+
+		// Output may be split by lines, hence redact each line as well
+		for _, line := range strings.Split(val, "\n") {
+			if line = strings.TrimSpace(line); len(line) >= minSecretValueLen && line != val {
+				result = append(result, line)
+			}
+		}
+	}
+
+	return result
+}
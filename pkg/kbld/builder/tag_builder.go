@@ -7,12 +7,16 @@ import (
 	"crypto/rand"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
 )
 
 var (
-	tagBuilderTagCleanRegexp = regexp.MustCompile("[^a-zA-Z0-9\\-]+")
+	tagBuilderTagCleanRegexp  = regexp.MustCompile("[^a-zA-Z0-9\\-]+")
+	tagBuilderRandomStrRegexp = regexp.MustCompile("^rand-(\\d+)-\\d+")
 )
 
 type TagBuilder struct{}
@@ -58,6 +62,42 @@ func (d TagBuilder) RandomStr50() (string, error) {
 	return d.CheckLen(fmt.Sprintf("rand-%d-%s", time.Now().UTC().UnixNano(), result), 50), nil
 }
 
+// RandomPushTagRef returns image destination tagged with random tag
+// (kbld-rand-...) for pushing images whose digest is not known upfront
+// (such tags can be replaced with digest derived tags via kbld gc)
+func (d TagBuilder) RandomPushTagRef(imageDst string) (regname.Tag, error) {
+	randStr, err := d.RandomStr50()
+	if err != nil {
+		return regname.Tag{}, fmt.Errorf("Generating image dst suffix: %s", err)
+	}
+
+	tagRef, err := regname.NewTag(imageDst+":kbld-"+randStr, regname.WeakValidation)
+	if err != nil {
+		return regname.Tag{}, fmt.Errorf("Validating destination tag ref '%s': %s", imageDst, err)
+	}
+
+	return tagRef, nil
+}
+
+// DigestTag returns tag derived from digest (e.g. kbld-sha256-...)
+func (d TagBuilder) DigestTag(digest string) string {
+	return "kbld-" + strings.Replace(digest, ":", "-", 1)
+}
+
+// RandomStrTime returns time when string produced by RandomStr50
+// was generated (string may be followed by other content)
+func (d TagBuilder) RandomStrTime(str string) (time.Time, bool) {
+	match := tagBuilderRandomStrRegexp.FindStringSubmatch(str)
+	if len(match) != 2 {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos).UTC(), true
+}
+
 func (d TagBuilder) randomBytes(n int) ([]byte, error) {
 	bs := make([]byte, n)
 	_, err := rand.Read(bs)
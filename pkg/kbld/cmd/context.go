@@ -0,0 +1,28 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// newCmdContext returns context that is cancelled when process
+// is interrupted (e.g. Ctrl-C) or when timeout (if non-zero) passes
+func newCmdContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancelSignal := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if timeout == 0 {
+		return ctx, cancelSignal
+	}
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+
+	return ctx, func() {
+		cancelTimeout()
+		cancelSignal()
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlgc "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/gc"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+type GCOptions struct {
+	ui ui.UI
+
+	RegistryFlags RegistryFlags
+
+	Keep                int
+	OlderThan           time.Duration
+	RandomTagsOlderThan time.Duration
+	Local               bool
+	Repositories        []string
+	DryRun              bool
+
+	DockerHost    string
+	DockerContext string
+}
+
+func NewGCOptions(ui ui.UI) *GCOptions {
+	return &GCOptions{ui: ui}
+}
+
+func NewGCCmd(o *GCOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove stale images left behind by builds",
+		Long: `Remove stale images left behind by builds.
+
+Locally built images (kbld:<image>-sha256-...) are removed unless they are
+one of the most recent builds of an image (see --keep); with --older-than
+builds created before given duration ago are removed as well.
+
+Random tags ((kbld-)rand-...) used for pushing images to given repositories
+are replaced with digest derived tags (kbld-sha256-...) so that pushed images
+remain tagged. Note that registry has to support deleting tags.
+
+Random tags (and temporary local tags) are only removed once they are older
+than --random-tags-older-than since builds and pushes that are still
+in progress (e.g. in concurrently running kbld) rely on them.
+`,
+		RunE: func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+	o.RegistryFlags.Set(cmd)
+	cmd.Flags().IntVar(&o.Keep, "keep", 3, "Set number of most recent local builds to keep per image")
+	cmd.Flags().DurationVar(&o.OlderThan, "older-than", 0, "Remove local builds created before given duration ago (e.g. 168h) (0 removes regardless of age)")
+	cmd.Flags().DurationVar(&o.RandomTagsOlderThan, "random-tags-older-than", 24*time.Hour, "Remove random registry tags and temporary local tags created before given duration ago (0 removes regardless of age)")
+	cmd.Flags().BoolVar(&o.Local, "local", true, "Remove stale images from local Docker daemon")
+	cmd.Flags().StringSliceVarP(&o.Repositories, "repository", "r", nil, "Remove random push tags from given image repository (e.g. docker.io/dkalinin/my-project) (can be specified multiple times)")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "Only print what would be removed")
+	cmd.Flags().StringVar(&o.DockerHost, "docker-host", "", "Set Docker daemon to clean up (e.g. ssh://user@host) (same as DOCKER_HOST)")
+	cmd.Flags().StringVar(&o.DockerContext, "docker-context", "", "Set Docker context of daemon to clean up")
+	return cmd
+}
+
+func (o *GCOptions) Run() error {
+	if o.Keep < 0 {
+		return fmt.Errorf("Expected keep flag to be non-negative")
+	}
+	if o.OlderThan < 0 {
+		return fmt.Errorf("Expected older-than flag to be non-negative")
+	}
+	if o.RandomTagsOlderThan < 0 {
+		return fmt.Errorf("Expected random-tags-older-than flag to be non-negative")
+	}
+	if len(o.DockerHost) > 0 && len(o.DockerContext) > 0 {
+		return fmt.Errorf("Expected only one of docker-host or docker-context flags to be specified")
+	}
+
+	logger := ctllog.NewLogger(os.Stderr)
+
+	registryOpts, err := o.RegistryFlags.AsRegistryOpts(logger)
+	if err != nil {
+		return err
+	}
+
+	registry, err := ctlreg.NewRegistry(registryOpts)
+	if err != nil {
+		return err
+	}
+
+	defer registry.WriteDebugSummary()
+
+	ctx, cancel := newCmdContext(0)
+	defer cancel()
+
+	gcOpts := ctlgc.Opts{
+		Keep:                o.Keep,
+		OlderThan:           o.OlderThan,
+		RandomTagsOlderThan: o.RandomTagsOlderThan,
+		DryRun:              o.DryRun,
+	}
+	gc := ctlgc.NewGC(ctlbdk.NewDocker(logger).WithDaemon(o.dockerDaemon()), registry, gcOpts, logger)
+
+	if o.Local {
+		removed, err := gc.CleanLocal(ctx)
+		if err != nil {
+			return err
+		}
+		o.ui.PrintLinef("Removed %d local image(s)", removed)
+	}
+
+	for _, repoStr := range o.Repositories {
+		repo, err := regname.NewRepository(repoStr)
+		if err != nil {
+			return fmt.Errorf("Building repository ref: %s", err)
+		}
+
+		deleted, err := gc.CleanRepository(ctx, repo)
+		if err != nil {
+			return err
+		}
+		o.ui.PrintLinef("Replaced %d random tag(s) in %s", deleted, repo.Name())
+	}
+
+	return nil
+}
+
+func (o *GCOptions) dockerDaemon() ctlbdk.DockerDaemon {
+	var daemon ctlbdk.DockerDaemon
+	if len(o.DockerHost) > 0 {
+		daemon.Host = &o.DockerHost
+	}
+	if len(o.DockerContext) > 0 {
+		daemon.Context = &o.DockerContext
+	}
+	return daemon
+}
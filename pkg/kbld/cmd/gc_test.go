@@ -0,0 +1,76 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cppforlife/go-cli-ui/ui"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/cmd"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+func TestGCDockerDaemonFlags(t *testing.T) {
+	argsPath := filepath.Join(t.TempDir(), "args")
+
+	// Fake docker records its args and daemon host without listing any images
+	script := `#!/bin/sh
+echo "$1 $2 $3 (host: $DOCKER_HOST)" >> "` + argsPath + `"
+`
+	testutil.InstallCLI(t, "docker", script)
+
+	cases := []struct {
+		Description  string
+		Args         []string
+		ExpectedArgs string
+	}{
+		{"default daemon", nil, "images --no-trunc --format (host: )"},
+		{"docker host", []string{"--docker-host=ssh://builder@amd64-host"}, "images --no-trunc --format (host: ssh://builder@amd64-host)"},
+		{"docker context", []string{"--docker-context=amd64"}, "--context amd64 images (host: )"},
+	}
+
+	for _, c := range cases {
+		err := ioutil.WriteFile(argsPath, nil, 0600)
+		if err != nil {
+			t.Fatalf("Resetting args file: %s", err)
+		}
+
+		err = runGCCmd(c.Args)
+		if err != nil {
+			t.Fatalf("%s: Expected no error, but was: %s", c.Description, err)
+		}
+
+		bs, err := ioutil.ReadFile(argsPath)
+		if err != nil {
+			t.Fatalf("%s: Reading args file: %s", c.Description, err)
+		}
+
+		if args := strings.TrimSpace(string(bs)); args != c.ExpectedArgs {
+			t.Fatalf("%s: Expected args >>>%s<<< to match >>>%s<<<", c.Description, args, c.ExpectedArgs)
+		}
+	}
+}
+
+func TestGCDockerDaemonFlagsAreExclusive(t *testing.T) {
+	err := runGCCmd([]string{"--docker-host=ssh://builder@amd64-host", "--docker-context=amd64"})
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected only one of docker-host or docker-context flags to be specified"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+}
+
+func runGCCmd(args []string) error {
+	gcCmd := cmd.NewGCCmd(cmd.NewGCOptions(ui.NewNoopUI()))
+	gcCmd.SetArgs(args)
+	gcCmd.SilenceUsage = true
+	gcCmd.SilenceErrors = true
+	return gcCmd.Execute()
+}
@@ -4,10 +4,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
 	ctlimg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/image"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
 )
 
 type ImageQueue struct {
@@ -24,7 +26,7 @@ func NewImageQueue(imgFactory ctlimg.Factory) *ImageQueue {
 	return &ImageQueue{imgFactory: imgFactory}
 }
 
-func (b *ImageQueue) Run(unprocessedImageURLs *UnprocessedImageURLs, numWorkers int) (*ProcessedImages, error) {
+func (b *ImageQueue) Run(ctx context.Context, unprocessedImageURLs *UnprocessedImageURLs, numWorkers int) (*ProcessedImages, error) {
 	b.outputImages = NewProcessedImages()
 	b.outputErrs = nil
 
@@ -32,10 +34,14 @@ func (b *ImageQueue) Run(unprocessedImageURLs *UnprocessedImageURLs, numWorkers
 	workWg := sync.WaitGroup{}
 
 	for i := 0; i < numWorkers; i++ {
-		go b.worker(&workWg, queueCh)
+		go b.worker(ctx, &workWg, queueCh)
 	}
 
 	for _, unprocessedImageURL := range unprocessedImageURLs.All() {
+		// Do not start any new work once cancelled
+		if ctx.Err() != nil {
+			break
+		}
 		workWg.Add(1)
 		queueCh <- unprocessedImageURL
 	}
@@ -43,19 +49,25 @@ func (b *ImageQueue) Run(unprocessedImageURLs *UnprocessedImageURLs, numWorkers
 	workWg.Wait()
 	close(queueCh)
 
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("Resolving images: %s", ctx.Err())
+	}
+
 	return b.outputImages, errFromErrs(b.outputErrs)
 }
 
-func (b *ImageQueue) worker(workWg *sync.WaitGroup, queueCh <-chan UnprocessedImageURL) {
+func (b *ImageQueue) worker(ctx context.Context, workWg *sync.WaitGroup, queueCh <-chan UnprocessedImageURL) {
 	for unprocessedImageURL := range queueCh {
-		b.work(workWg, unprocessedImageURL)
+		b.work(ctx, workWg, unprocessedImageURL)
 	}
 }
 
-func (b *ImageQueue) work(workWg *sync.WaitGroup, unprocessedImageURL UnprocessedImageURL) {
+func (b *ImageQueue) work(ctx context.Context, workWg *sync.WaitGroup, unprocessedImageURL UnprocessedImageURL) {
 	defer workWg.Done()
 
-	imgURL, origins, err := b.imgFactory.New(unprocessedImageURL.URL).URL()
+	ctx = ctlreg.WithDebugLogPrefix(ctx, unprocessedImageURL.URL)
+
+	imgURL, origins, err := b.imgFactory.New(unprocessedImageURL.URL).URL(ctx)
 	if err != nil {
 		b.outputErrsLock.Lock()
 		b.outputErrs = append(b.outputErrs, fmt.Errorf("Resolving image '%s': %s", unprocessedImageURL.URL, err))
@@ -4,6 +4,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	regname "github.com/google/go-containerregistry/pkg/name"
@@ -19,18 +20,18 @@ type ImageSet struct {
 	logger      *ctllog.PrefixWriter
 }
 
-func (o ImageSet) Relocate(foundImages *UnprocessedImageURLs,
+func (o ImageSet) Relocate(ctx context.Context, foundImages *UnprocessedImageURLs,
 	importRepo regname.Repository, registry ctlreg.Registry) (*ProcessedImages, error) {
 
-	ids, err := o.Export(foundImages, registry)
+	ids, err := o.Export(ctx, foundImages, registry)
 	if err != nil {
 		return nil, err
 	}
 
-	return o.Import(imagedesc.NewDescribedReader(ids, ids).Read(), importRepo, registry)
+	return o.Import(ctx, imagedesc.NewDescribedReader(ids, ids).Read(), importRepo, registry)
 }
 
-func (o ImageSet) Export(foundImages *UnprocessedImageURLs,
+func (o ImageSet) Export(ctx context.Context, foundImages *UnprocessedImageURLs,
 	registry ctlreg.Registry) (*imagedesc.ImageRefDescriptors, error) {
 
 	o.logger.WriteStr("exporting %d images...\n", len(foundImages.All()))
@@ -49,7 +50,7 @@ func (o ImageSet) Export(foundImages *UnprocessedImageURLs,
 		refs = append(refs, ref)
 	}
 
-	ids, err := imagedesc.NewImageRefDescriptors(refs, registry)
+	ids, err := imagedesc.NewImageRefDescriptors(ctx, refs, registry)
 	if err != nil {
 		return nil, fmt.Errorf("Collecting packaging metadata: %s", err)
 	}
@@ -57,7 +58,7 @@ func (o ImageSet) Export(foundImages *UnprocessedImageURLs,
 	return ids, nil
 }
 
-func (o *ImageSet) Import(imgOrIndexes []imagedesc.ImageOrIndex,
+func (o *ImageSet) Import(ctx context.Context, imgOrIndexes []imagedesc.ImageOrIndex,
 	importRepo regname.Repository, registry ctlreg.Registry) (*ProcessedImages, error) {
 
 	importedImages := NewProcessedImages()
@@ -81,7 +82,7 @@ func (o *ImageSet) Import(imgOrIndexes []imagedesc.ImageOrIndex,
 				return
 			}
 
-			importDigestRef, err := o.importImage(item, existingRef, importRepo, registry)
+			importDigestRef, err := o.importImage(ctx, item, existingRef, importRepo, registry)
 			if err != nil {
 				errCh <- fmt.Errorf("Importing image %s: %s", existingRef.Name(), err)
 				return
@@ -102,7 +103,7 @@ func (o *ImageSet) Import(imgOrIndexes []imagedesc.ImageOrIndex,
 	return importedImages, nil
 }
 
-func (o *ImageSet) importImage(item imagedesc.ImageOrIndex,
+func (o *ImageSet) importImage(ctx context.Context, item imagedesc.ImageOrIndex,
 	existingRef regname.Digest, importRepo regname.Repository,
 	registry ctlreg.Registry) (regname.Digest, error) {
 
@@ -126,13 +127,13 @@ func (o *ImageSet) importImage(item imagedesc.ImageOrIndex,
 
 	switch {
 	case item.Image != nil:
-		err = registry.WriteImage(uploadTagRef, *item.Image)
+		err = registry.WriteImage(ctx, uploadTagRef, *item.Image)
 		if err != nil {
 			return regname.Digest{}, fmt.Errorf("Importing image as %s: %s", importDigestRef.Name(), err)
 		}
 
 	case item.Index != nil:
-		err = registry.WriteIndex(uploadTagRef, *item.Index)
+		err = registry.WriteIndex(ctx, uploadTagRef, *item.Index)
 		if err != nil {
 			return regname.Digest{}, fmt.Errorf("Importing image index as %s: %s", importDigestRef.Name(), err)
 		}
@@ -145,7 +146,7 @@ func (o *ImageSet) importImage(item imagedesc.ImageOrIndex,
 	// Being a little bit paranoid here because tag ref is used for import
 	// instead of plain digest ref, because AWS ECR doesnt like digests
 	// during manifest upload.
-	err = o.verifyTagDigest(uploadTagRef, importDigestRef, registry)
+	err = o.verifyTagDigest(ctx, uploadTagRef, importDigestRef, registry)
 	if err != nil {
 		return regname.Digest{}, err
 	}
@@ -153,10 +154,10 @@ func (o *ImageSet) importImage(item imagedesc.ImageOrIndex,
 	return importDigestRef, nil
 }
 
-func (o *ImageSet) verifyTagDigest(
+func (o *ImageSet) verifyTagDigest(ctx context.Context,
 	uploadTagRef regname.Reference, importDigestRef regname.Digest, registry ctlreg.Registry) error {
 
-	resultURL, _, err := ctlimg.NewResolvedImage(uploadTagRef.Name(), registry).URL()
+	resultURL, _, err := ctlimg.NewResolvedImage(uploadTagRef.Name(), registry).URL(ctx)
 	if err != nil {
 		return fmt.Errorf("Verifying imported image %s: %s", uploadTagRef.Name(), err)
 	}
@@ -51,6 +51,7 @@ func NewKbldCmd(o *KbldOptions) *cobra.Command {
 	cmd.AddCommand(NewUnpackageCmd(NewUnpackageOptions(o.ui)))
 	cmd.AddCommand(NewVersionCmd(NewVersionOptions(o.ui)))
 	cmd.AddCommand(NewRelocateCmd(NewRelocateOptions(o.ui)))
+	cmd.AddCommand(NewGCCmd(NewGCOptions(o.ui)))
 
 	// Last one runs first
 	cobrautil.VisitCommands(cmd, cobrautil.ReconfigureCmdWithSubcmd)
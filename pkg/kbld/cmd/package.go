@@ -77,14 +77,24 @@ func (o *PackageOptions) Run() error {
 		return err
 	}
 
-	registry, err := ctlreg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	registryOpts, err := o.RegistryFlags.AsRegistryOpts(logger)
 	if err != nil {
 		return err
 	}
 
+	registry, err := ctlreg.NewRegistry(registryOpts)
+	if err != nil {
+		return err
+	}
+
+	defer registry.WriteDebugSummary()
+
 	imageSet := TarImageSet{ImageSet{o.Concurrency, prefixedLogger}, o.Concurrency, prefixedLogger}
 
-	return imageSet.Export(foundImages, o.OutputPath, registry)
+	ctx, cancel := newCmdContext(0)
+	defer cancel()
+
+	return imageSet.Export(ctx, foundImages, o.OutputPath, registry)
 }
 
 func FindImages(allRs []ctlres.Resource, conf ctlconf.Conf) (*UnprocessedImageURLs, error) {
@@ -4,27 +4,138 @@
 package cmd
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
 	"github.com/spf13/cobra"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
 	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
 )
 
 type RegistryFlags struct {
-	CACertPaths []string
-	VerifyCerts bool
-	Insecure    bool
+	CACertPaths    []string
+	VerifyCerts    bool
+	Insecure       bool
+	ClientCertPath string
+	ClientKeyPath  string
+
+	// Per registry settings keyed by hostname
+	HostCACertPaths map[string]string
+	HostVerifyCerts map[string]string
+	HostInsecure    map[string]string
+
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	OperationTimeout      time.Duration
+
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    []string
+
+	Debug bool
 }
 
 func (s *RegistryFlags) Set(cmd *cobra.Command) {
 	cmd.Flags().StringSliceVar(&s.CACertPaths, "registry-ca-cert-path", nil, "Add CA certificates for registry API (format: /tmp/foo) (can be specified multiple times)")
 	cmd.Flags().BoolVar(&s.VerifyCerts, "registry-verify-certs", true, "Set whether to verify server's certificate chain and host name")
 	cmd.Flags().BoolVar(&s.Insecure, "registry-insecure", false, "Allow the use of http when interacting with registries")
+	cmd.Flags().StringVar(&s.ClientCertPath, "registry-client-cert", "", "Set client certificate for registry API (format: /tmp/foo) (password for encrypted key is read from KBLD_REGISTRY_CLIENT_KEY_PASSWORD)")
+	cmd.Flags().StringToStringVar(&s.HostCACertPaths, "registry-host-ca-cert-path", nil, "Add CA certificate for a single registry (format: registry.io=/tmp/foo) (can be specified multiple times) (same as KBLD_REGISTRY_HOSTNAME_N and KBLD_REGISTRY_CA_CERT_PATH_N env vars)")
+	cmd.Flags().StringToStringVar(&s.HostVerifyCerts, "registry-host-verify-certs", nil, "Set whether to verify certificate chain and host name of a single registry (format: registry.io=false) (can be specified multiple times) (same as KBLD_REGISTRY_VERIFY_CERTS_N env var)")
+	cmd.Flags().StringToStringVar(&s.HostInsecure, "registry-host-insecure", nil, "Set whether to allow the use of http for a single registry (format: registry.io=true) (can be specified multiple times) (same as KBLD_REGISTRY_INSECURE_N env var)")
+	cmd.Flags().StringVar(&s.ClientKeyPath, "registry-client-key", "", "Set client key for registry API (format: /tmp/foo) (PEM encoded; may be encrypted as PKCS#8 or legacy PEM)")
+
+	cmd.Flags().DurationVar(&s.DialTimeout, "registry-dial-timeout", 30*time.Second, "Set timeout for establishing connections to registries (0 means no timeout)")
+	cmd.Flags().DurationVar(&s.TLSHandshakeTimeout, "registry-tls-handshake-timeout", 10*time.Second, "Set timeout for TLS handshakes with registries (0 means no timeout)")
+	cmd.Flags().DurationVar(&s.ResponseHeaderTimeout, "registry-response-header-timeout", 10*time.Second, "Set timeout for waiting on registry response headers (0 means no timeout)")
+	cmd.Flags().DurationVar(&s.IdleConnTimeout, "registry-idle-conn-timeout", 90*time.Second, "Set how long idle registry connections are kept open (0 means no limit)")
+	cmd.Flags().IntVar(&s.MaxIdleConns, "registry-max-idle-conns", 100, "Set maximum number of idle registry connections (0 means no limit)")
+	cmd.Flags().DurationVar(&s.OperationTimeout, "registry-operation-timeout", 0, "Set timeout for each registry operation including retries (e.g. 5m) (0 means no timeout)")
+
+	cmd.Flags().StringVar(&s.HTTPProxy, "registry-http-proxy", "", "Set proxy for HTTP registry requests (defaults to HTTP_PROXY env var)")
+	cmd.Flags().StringVar(&s.HTTPSProxy, "registry-https-proxy", "", "Set proxy for HTTPS registry requests (defaults to HTTPS_PROXY env var)")
+	cmd.Flags().StringSliceVar(&s.NoProxy, "registry-no-proxy", nil, "Set hosts that should not be proxied (format: example.com, .example.com, 10.0.0.0/8) (can be specified multiple times) (defaults to NO_PROXY env var)")
+
+	cmd.Flags().BoolVar(&s.Debug, "registry-debug", false, "Log each registry request and summary of requests per registry")
 }
 
-func (s *RegistryFlags) AsRegistryOpts() ctlreg.Opts {
-	return ctlreg.Opts{
+func (s *RegistryFlags) AsRegistryOpts(logger ctllog.Logger) (ctlreg.Opts, error) {
+	opts := ctlreg.Opts{
 		CACertPaths:   s.CACertPaths,
 		VerifyCerts:   s.VerifyCerts,
 		Insecure:      s.Insecure,
 		EnvAuthPrefix: "KBLD_REGISTRY",
+
+		ClientCertPath: s.ClientCertPath,
+		ClientKeyPath:  s.ClientKeyPath,
+
+		DialTimeout:           &s.DialTimeout,
+		TLSHandshakeTimeout:   &s.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: &s.ResponseHeaderTimeout,
+		IdleConnTimeout:       &s.IdleConnTimeout,
+		MaxIdleConns:          &s.MaxIdleConns,
+		OperationTimeout:      s.OperationTimeout,
+
+		HTTPProxy:  s.HTTPProxy,
+		HTTPSProxy: s.HTTPSProxy,
+		NoProxy:    s.NoProxy,
+	}
+	if s.Debug {
+		opts.DebugLogger = &logger
 	}
+
+	hosts, err := s.hostsOpts()
+	if err != nil {
+		return ctlreg.Opts{}, err
+	}
+	opts.Hosts = hosts
+
+	return opts, nil
+}
+
+func (s *RegistryFlags) hostsOpts() ([]ctlreg.HostOpts, error) {
+	hostsOpts := map[string]*ctlreg.HostOpts{}
+
+	hostOpts := func(hostname string) *ctlreg.HostOpts {
+		if _, found := hostsOpts[hostname]; !found {
+			hostsOpts[hostname] = &ctlreg.HostOpts{Hostname: hostname}
+		}
+		return hostsOpts[hostname]
+	}
+
+	for hostname, path := range s.HostCACertPaths {
+		opts := hostOpts(hostname)
+		opts.CACertPaths = append(opts.CACertPaths, path)
+	}
+
+	for hostname, val := range s.HostVerifyCerts {
+		verifyCerts, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("Expected registry-host-verify-certs value for '%s' to be a boolean: %s", hostname, err)
+		}
+		hostOpts(hostname).VerifyCerts = &verifyCerts
+	}
+
+	for hostname, val := range s.HostInsecure {
+		insecure, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("Expected registry-host-insecure value for '%s' to be a boolean: %s", hostname, err)
+		}
+		hostOpts(hostname).Insecure = &insecure
+	}
+
+	var result []ctlreg.HostOpts
+	for _, opts := range hostsOpts {
+		result = append(result, *opts)
+	}
+
+	// Keep order stable since map iteration order is random
+	sort.Slice(result, func(i, j int) bool { return result[i].Hostname < result[j].Hostname })
+
+	return result, nil
 }
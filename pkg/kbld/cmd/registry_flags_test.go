@@ -0,0 +1,133 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/cmd"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+func TestRegistryFlagsTimeouts(t *testing.T) {
+	cases := []struct {
+		Description string
+		Args        []string
+		Check       func(ctlreg.Opts) (time.Duration, time.Duration)
+	}{
+		{"dial timeout", []string{"--registry-dial-timeout=1s"},
+			func(o ctlreg.Opts) (time.Duration, time.Duration) { return *o.DialTimeout, 30 * time.Second }},
+		{"TLS handshake timeout", []string{"--registry-tls-handshake-timeout=1s"},
+			func(o ctlreg.Opts) (time.Duration, time.Duration) { return *o.TLSHandshakeTimeout, 10 * time.Second }},
+		{"response header timeout", []string{"--registry-response-header-timeout=1s"},
+			func(o ctlreg.Opts) (time.Duration, time.Duration) { return *o.ResponseHeaderTimeout, 10 * time.Second }},
+		{"idle conn timeout", []string{"--registry-idle-conn-timeout=1s"},
+			func(o ctlreg.Opts) (time.Duration, time.Duration) { return *o.IdleConnTimeout, 90 * time.Second }},
+		{"operation timeout", []string{"--registry-operation-timeout=1s"},
+			func(o ctlreg.Opts) (time.Duration, time.Duration) { return o.OperationTimeout, 0 }},
+	}
+
+	for _, c := range cases {
+		defaultOpts := registryOptsFromArgs(t, nil)
+		if val, expectedVal := c.Check(defaultOpts); val != expectedVal {
+			t.Fatalf("%s: Expected default %s, but was %s", c.Description, expectedVal, val)
+		}
+
+		opts := registryOptsFromArgs(t, c.Args)
+		if val, _ := c.Check(opts); val != time.Second {
+			t.Fatalf("%s: Expected %s, but was %s", c.Description, time.Second, val)
+		}
+
+		// Zero disables timeout instead of falling back to default
+		opts = registryOptsFromArgs(t, []string{strings.Replace(c.Args[0], "=1s", "=0", 1)})
+		if val, _ := c.Check(opts); val != 0 {
+			t.Fatalf("%s: Expected no timeout, but was %s", c.Description, val)
+		}
+	}
+}
+
+func TestRegistryFlagsConnectionSettings(t *testing.T) {
+	opts := registryOptsFromArgs(t, nil)
+	if *opts.MaxIdleConns != 100 {
+		t.Fatalf("Expected default max idle conns 100, but was %d", *opts.MaxIdleConns)
+	}
+
+	opts = registryOptsFromArgs(t, []string{
+		"--registry-max-idle-conns=5",
+		"--registry-http-proxy=http://proxy.io:3128",
+		"--registry-https-proxy=http://proxy.io:3129",
+		"--registry-no-proxy=internal.io,.corp.io",
+	})
+
+	if *opts.MaxIdleConns != 5 {
+		t.Fatalf("Expected max idle conns 5, but was %d", *opts.MaxIdleConns)
+	}
+	if opts.HTTPProxy != "http://proxy.io:3128" || opts.HTTPSProxy != "http://proxy.io:3129" {
+		t.Fatalf("Expected proxies to be set, but was >>>%s<<< and >>>%s<<<", opts.HTTPProxy, opts.HTTPSProxy)
+	}
+	if len(opts.NoProxy) != 2 || opts.NoProxy[0] != "internal.io" || opts.NoProxy[1] != ".corp.io" {
+		t.Fatalf("Expected no proxy hosts to be set, but was %#v", opts.NoProxy)
+	}
+}
+
+func TestRegistryFlagsHostSettings(t *testing.T) {
+	opts := registryOptsFromArgs(t, []string{
+		"--registry-host-ca-cert-path=registry.io=/tmp/ca.crt",
+		"--registry-host-verify-certs=registry.io=false",
+		"--registry-host-insecure=localhost:5000=true,other.io=false",
+	})
+
+	falseVal := false
+	trueVal := true
+
+	expectedHosts := []ctlreg.HostOpts{
+		{Hostname: "localhost:5000", Insecure: &trueVal},
+		{Hostname: "other.io", Insecure: &falseVal},
+		{Hostname: "registry.io", CACertPaths: []string{"/tmp/ca.crt"}, VerifyCerts: &falseVal},
+	}
+
+	if !reflect.DeepEqual(opts.Hosts, expectedHosts) {
+		t.Fatalf("Expected hosts >>>%#v<<< to match >>>%#v<<<", opts.Hosts, expectedHosts)
+	}
+
+	var flags cmd.RegistryFlags
+
+	cobraCmd := &cobra.Command{}
+	flags.Set(cobraCmd)
+
+	err := cobraCmd.Flags().Parse([]string{"--registry-host-insecure=registry.io=maybe"})
+	if err != nil {
+		t.Fatalf("Parsing flags: %s", err)
+	}
+
+	_, err = flags.AsRegistryOpts(ctllog.NewLogger(&bytes.Buffer{}))
+	if err == nil || !strings.Contains(err.Error(), "Expected registry-host-insecure value for 'registry.io' to be a boolean") {
+		t.Fatalf("Expected boolean parsing error, but was: %v", err)
+	}
+}
+
+func registryOptsFromArgs(t *testing.T, args []string) ctlreg.Opts {
+	var flags cmd.RegistryFlags
+
+	cobraCmd := &cobra.Command{}
+	flags.Set(cobraCmd)
+
+	err := cobraCmd.Flags().Parse(args)
+	if err != nil {
+		t.Fatalf("Parsing flags: %s", err)
+	}
+
+	opts, err := flags.AsRegistryOpts(ctllog.NewLogger(&bytes.Buffer{}))
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	return opts
+}
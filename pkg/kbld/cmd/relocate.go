@@ -88,14 +88,24 @@ func (o *RelocateOptions) Run() error {
 		return fmt.Errorf("Building import repository ref: %s", err)
 	}
 
-	dstRegistry, err := ctlreg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	registryOpts, err := o.RegistryFlags.AsRegistryOpts(logger)
 	if err != nil {
 		return err
 	}
 
+	dstRegistry, err := ctlreg.NewRegistry(registryOpts)
+	if err != nil {
+		return err
+	}
+
+	defer dstRegistry.WriteDebugSummary()
+
+	ctx, cancel := newCmdContext(0)
+	defer cancel()
+
 	imageSet := ImageSet{o.Concurrency, prefixedLogger}
 
-	importedImages, err := imageSet.Relocate(foundImages, importRepo, dstRegistry)
+	importedImages, err := imageSet.Relocate(ctx, foundImages, importRepo, dstRegistry)
 	if err != nil {
 		return err
 	}
@@ -4,15 +4,20 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/cppforlife/go-cli-ui/ui"
 	"github.com/spf13/cobra"
 	"github.com/vmware-tanzu/carvel-imgpkg/pkg/imgpkg/lockconfig"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbc "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/cache"
 	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 	ctlimg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/image"
 	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
@@ -30,11 +35,17 @@ type ResolveOptions struct {
 	RegistryFlags     RegistryFlags
 	AllowedToBuild    bool
 	BuildConcurrency  int
+	ProvenanceLabels  bool
+	BuildCache        bool
+	BuildCacheDir     string
+	BuildLogDir       string
 	ImagesAnnotation  bool
 	ImageMapFile      string
 	LockOutput        string
 	ImgpkgLockOutput  string
 	UnresolvedInspect bool
+	Plan              bool
+	Timeout           time.Duration
 }
 
 func NewResolveOptions(ui ui.UI) *ResolveOptions {
@@ -51,11 +62,17 @@ func NewResolveCmd(o *ResolveOptions) *cobra.Command {
 	o.RegistryFlags.Set(cmd)
 	cmd.Flags().BoolVar(&o.AllowedToBuild, "build", true, "Allow building of images")
 	cmd.Flags().IntVar(&o.BuildConcurrency, "build-concurrency", 4, "Set maximum number of concurrent builds")
+	cmd.Flags().BoolVar(&o.ProvenanceLabels, "build-provenance-labels", false, "Add OCI labels (revision, source, created, version) based on git details to built images (pack builds require paketo image-labels buildpack; ko, bazel and exec builds are not supported)")
+	cmd.Flags().BoolVar(&o.BuildCache, "build-cache", false, "Skip building pushed images when source contents and build options are unchanged")
+	cmd.Flags().StringVar(&o.BuildCacheDir, "build-cache-dir", "", "Set build cache directory (defaults to kbld directory within user cache directory)")
+	cmd.Flags().StringVar(&o.BuildLogDir, "build-log-dir", "", "Write build output of each image into its own file within directory (only summary is printed)")
 	cmd.Flags().BoolVar(&o.ImagesAnnotation, "images-annotation", true, "Annotate resources with images annotation")
 	cmd.Flags().StringVar(&o.ImageMapFile, "image-map-file", "", "Set image map file (/cnab/app/relocation-mapping.json in CNAB)")
 	cmd.Flags().StringVar(&o.LockOutput, "lock-output", "", "File path to emit configuration with resolved image references")
 	cmd.Flags().StringVar(&o.ImgpkgLockOutput, "imgpkg-lock-output", "", "File path to emit images lockfile with resolved image references")
 	cmd.Flags().BoolVar(&o.UnresolvedInspect, "unresolved-inspect", false, "List image references found in inputs")
+	cmd.Flags().BoolVar(&o.Plan, "plan", false, "Print how each image would be resolved (overridden, built, pushed, etc.) without building, pushing or tagging")
+	cmd.Flags().DurationVar(&o.Timeout, "timeout", 0, "Set maximum duration for resolving images including builds and pushes (e.g. 10m) (0 means no timeout)")
 	return cmd
 }
 
@@ -66,7 +83,10 @@ func (o *ResolveOptions) Run() error {
 	logger := ctllog.NewLogger(os.Stderr)
 	prefixedLogger := logger.NewPrefixedWriter("resolve | ")
 
-	resBss, err := o.ResolveResources(&logger, prefixedLogger)
+	ctx, cancel := newCmdContext(o.Timeout)
+	defer cancel()
+
+	resBss, err := o.ResolveResources(ctx, &logger, prefixedLogger)
 	if err != nil {
 		return err
 	}
@@ -80,7 +100,7 @@ func (o *ResolveOptions) Run() error {
 	return nil
 }
 
-func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog.PrefixWriter) ([][]byte, error) {
+func (o *ResolveOptions) ResolveResources(ctx context.Context, logger *ctllog.Logger, pLogger *ctllog.PrefixWriter) ([][]byte, error) {
 	nonConfigRs, conf, err := o.FileFlags.ResourcesAndConfig()
 	if err != nil {
 		return nil, err
@@ -91,12 +111,39 @@ func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog
 		return nil, err
 	}
 
-	registry, err := ctlreg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	// Make sure that build secrets never show up in logs (e.g. echoed by build steps)
+	for _, src := range conf.Sources() {
+		logger.Redact(ctlb.SecretValues(src.ContextPath(), src.BuildSecrets())...)
+	}
+
+	registryOpts, err := o.RegistryFlags.AsRegistryOpts(*logger)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := ctlreg.NewRegistry(registryOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: o.AllowedToBuild}
+	defer registry.WriteDebugSummary()
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: o.AllowedToBuild, ProvenanceLabels: o.ProvenanceLabels}
+
+	if o.BuildCache {
+		buildCache, err := o.buildCache()
+		if err != nil {
+			return nil, err
+		}
+		opts.BuildCache = &buildCache
+	}
+	if len(o.BuildLogDir) > 0 && !o.Plan {
+		err := os.MkdirAll(o.BuildLogDir, 0700)
+		if err != nil {
+			return nil, fmt.Errorf("Creating build log directory: %s", err)
+		}
+		opts.BuildLogDir = o.BuildLogDir
+	}
 	imgFactory := ctlimg.NewFactory(opts, registry, *logger)
 
 	imageURLs, err := o.collectImageReferences(nonConfigRs, conf)
@@ -113,7 +160,14 @@ func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog
 		return nil, nil
 	}
 
-	resolvedImages, err := o.resolveImages(imageURLs, imgFactory)
+	if o.Plan {
+		for _, imageURL := range imageURLs.All() {
+			o.ui.PrintBlock([]byte(imgFactory.Plan(imageURL.URL).Description()))
+		}
+		return nil, nil
+	}
+
+	resolvedImages, err := o.resolveImages(ctx, imageURLs, imgFactory)
 	if err != nil {
 		return nil, err
 	}
@@ -136,6 +190,18 @@ func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog
 	return resBss, nil
 }
 
+func (o *ResolveOptions) buildCache() (ctlbc.Cache, error) {
+	dir := o.BuildCacheDir
+	if len(dir) == 0 {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return ctlbc.Cache{}, fmt.Errorf("Determining build cache directory: %s", err)
+		}
+		dir = filepath.Join(userCacheDir, "kbld", "builds")
+	}
+	return ctlbc.NewCache(dir), nil
+}
+
 func (o *ResolveOptions) collectImageReferences(nonConfigRs []ctlres.Resource,
 	conf ctlconf.Conf) (*UnprocessedImageURLs, error) {
 	imageURLs := NewUnprocessedImageURLs()
@@ -152,10 +218,10 @@ func (o *ResolveOptions) collectImageReferences(nonConfigRs []ctlres.Resource,
 	return imageURLs, nil
 }
 
-func (o *ResolveOptions) resolveImages(imageURLs *UnprocessedImageURLs, imgFactory ctlimg.Factory) (*ProcessedImages, error) {
+func (o *ResolveOptions) resolveImages(ctx context.Context, imageURLs *UnprocessedImageURLs, imgFactory ctlimg.Factory) (*ProcessedImages, error) {
 	queue := NewImageQueue(imgFactory)
 
-	resolvedImages, err := queue.Run(imageURLs, o.BuildConcurrency)
+	resolvedImages, err := queue.Run(ctx, imageURLs, o.BuildConcurrency)
 	if err != nil {
 		return nil, err
 	}
@@ -246,6 +312,8 @@ func (o *ResolveOptions) withImageMapConf(conf ctlconf.Conf) (ctlconf.Conf, erro
 		})
 	}
 
+	additionalConfig = additionalConfig.WithDefinedIn(fmt.Sprintf("image map file '%s'", o.ImageMapFile))
+
 	return conf.WithAdditionalConfig(additionalConfig), nil
 }
 
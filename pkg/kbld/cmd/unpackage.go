@@ -83,15 +83,25 @@ func (o *UnpackageOptions) Run() error {
 		return fmt.Errorf("Building import repository ref: %s", err)
 	}
 
-	registry, err := ctlreg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	registryOpts, err := o.RegistryFlags.AsRegistryOpts(logger)
 	if err != nil {
 		return err
 	}
 
+	registry, err := ctlreg.NewRegistry(registryOpts)
+	if err != nil {
+		return err
+	}
+
+	defer registry.WriteDebugSummary()
+
 	imageSet := TarImageSet{ImageSet{o.Concurrency, prefixedLogger}, o.Concurrency, prefixedLogger}
 
+	ctx, cancel := newCmdContext(0)
+	defer cancel()
+
 	// Import images used in the manifests
-	importedImages, err := imageSet.Import(o.InputPath, importRepo, registry)
+	importedImages, err := imageSet.Import(ctx, o.InputPath, importRepo, registry)
 	if err != nil {
 		return err
 	}
@@ -6,6 +6,8 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 
 	semver "github.com/hashicorp/go-version"
 	"github.com/vmware-tanzu/carvel-imgpkg/pkg/imgpkg/lockconfig"
@@ -54,15 +56,49 @@ type Config struct {
 
 type Source struct {
 	ImageRef
+	// Path is source root used for build inputs and git state
 	Path string
+	// Context (relative path within Path) is used as build context; defaults to Path
+	// (e.g. Path may point to monorepo root and Context to service directory)
+	Context string `json:"context,omitempty"`
+
+	// WatchPaths (relative to Path) narrow down which files are treated as
+	// build inputs (e.g. when multiple images share monorepo root as context).
+	// Include and Exclude globs further filter files within watch paths.
+	// Build inputs determine git dirty state and build cache key.
+	WatchPaths []string `json:"watchPaths,omitempty"`
+	Include    []string `json:"include,omitempty"`
+	Exclude    []string `json:"exclude,omitempty"`
+
+	DependsOn []SourceDependency `json:"dependsOn,omitempty"`
+	// Secrets are passed to Dockerfile based builders
+	// (docker, buildx, kubectlBuildkit, buildah)
+	Secrets []SourceSecret `json:"secrets,omitempty"`
 
 	Docker          *SourceDockerOpts
+	Buildx          *SourceBuildxOpts
 	Pack            *SourcePackOpts
 	KubectlBuildkit *SourceKubectlBuildkitOpts
+	Kaniko          *SourceKanikoOpts
+	Buildah         *SourceBuildahOpts
 	Ko              *SourceKoOpts
 	Bazel           *SourceBazelOpts
+	Exec            *SourceExecOpts
+	Custom          *SourceCustomOpts
 }
 
+const (
+	SourceTypeDocker          = "docker"
+	SourceTypeBuildx          = "buildx"
+	SourceTypePack            = "pack"
+	SourceTypeKubectlBuildkit = "kubectlBuildkit"
+	SourceTypeKaniko          = "kaniko"
+	SourceTypeBuildah         = "buildah"
+	SourceTypeKo              = "ko"
+	SourceTypeBazel           = "bazel"
+	SourceTypeExec            = "exec"
+)
+
 type ImageOverride struct {
 	ImageRef
 	NewImage     string                     `json:"newImage"`
@@ -75,6 +111,11 @@ type ImageDestination struct {
 	ImageRef
 	NewImage string   `json:"newImage"`
 	Tags     []string `json:"tags"`
+	// DigestTag pushes images built via Docker daemon with digest derived
+	// tag (kbld-sha256-...) instead of random one so that repeated pushes
+	// of identical images do not produce new tags (kaniko and buildah
+	// images are additionally tagged with it after being pushed)
+	DigestTag bool `json:"digestTag,omitempty"`
 }
 
 type SearchRule struct {
@@ -118,6 +159,25 @@ type SearchRuleUpdateStrategyYAML struct {
 type ImageRef struct {
 	Image     string `json:"image,omitempty"`
 	ImageRepo string `json:"imageRepo,omitempty"`
+
+	// definedIn describes where rule was configured (e.g. file path)
+	definedIn string
+}
+
+// DefinedIn describes where rule with this image ref was configured
+func (r ImageRef) DefinedIn() string { return r.definedIn }
+
+// Equal compares image refs regardless of where they were configured
+func (r ImageRef) Equal(other ImageRef) bool {
+	return r.Image == other.Image && r.ImageRepo == other.ImageRepo
+}
+
+// Description describes which images rule applies to
+func (r ImageRef) Description() string {
+	if len(r.ImageRepo) > 0 {
+		return fmt.Sprintf("imageRepo '%s'", r.ImageRepo)
+	}
+	return fmt.Sprintf("image '%s'", r.Image)
 }
 
 func NewConfig() Config {
@@ -152,7 +212,28 @@ func NewConfigFromResource(res ctlres.Resource) (Config, error) {
 		config.Destinations[i] = imageDst
 	}
 
-	return config, nil
+	return config.WithDefinedIn(res.Origin()), nil
+}
+
+// WithDefinedIn records where sources, overrides and destinations were configured
+func (d Config) WithDefinedIn(desc string) Config {
+	var sources []Source
+	for _, src := range d.Sources {
+		src.definedIn = desc
+		sources = append(sources, src)
+	}
+	var overrides []ImageOverride
+	for _, override := range d.Overrides {
+		override.definedIn = desc
+		overrides = append(overrides, override)
+	}
+	var dsts []ImageDestination
+	for _, dst := range d.Destinations {
+		dst.definedIn = desc
+		dsts = append(dsts, dst)
+	}
+	d.Sources, d.Overrides, d.Destinations = sources, overrides, dsts
+	return d
 }
 
 func NewConfigFromImagesLock(res ctlres.Resource) (Config, error) {
@@ -189,7 +270,7 @@ func NewConfigFromImagesLock(res ctlres.Resource) (Config, error) {
 		return Config{}, fmt.Errorf("Validating %s: %s", res.Description(), err)
 	}
 
-	return overridesConfig, nil
+	return overridesConfig.WithDefinedIn(res.Origin()), nil
 }
 
 func (d Config) Validate() error {
@@ -259,9 +340,150 @@ func (d Source) Validate() error {
 	if len(d.Path) == 0 {
 		return fmt.Errorf("Expected Path to be non-empty")
 	}
+	if len(d.Context) > 0 {
+		cleanPath := filepath.Clean(d.Context)
+		if filepath.IsAbs(d.Context) || cleanPath == ".." ||
+			strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("Expected Context to be a relative path within Path")
+		}
+	}
+	for i, watchPath := range d.WatchPaths {
+		cleanPath := filepath.Clean(watchPath)
+		if len(watchPath) == 0 || filepath.IsAbs(watchPath) ||
+			cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("Expected WatchPaths[%d] to be a relative path within Path", i)
+		}
+	}
+	for i, glob := range d.Include {
+		if len(glob) == 0 {
+			return fmt.Errorf("Expected Include[%d] to be non-empty", i)
+		}
+	}
+	for i, glob := range d.Exclude {
+		if len(glob) == 0 {
+			return fmt.Errorf("Expected Exclude[%d] to be non-empty", i)
+		}
+	}
+	for i, dep := range d.DependsOn {
+		if len(dep.Image) == 0 {
+			return fmt.Errorf("Expected DependsOn[%d].Image to be non-empty", i)
+		}
+	}
+	for i, secret := range d.Secrets {
+		err := secret.Validate(i)
+		if err != nil {
+			return err
+		}
+	}
+	if d.Custom != nil && len(d.Custom.Builder) == 0 {
+		return fmt.Errorf("Expected Custom.Builder to be non-empty")
+	}
+	if d.Docker != nil {
+		err := d.Docker.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if d.Buildx != nil {
+		err := d.Buildx.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if d.Pack != nil {
+		err := d.Pack.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if d.Ko != nil {
+		err := d.Ko.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if d.Bazel != nil {
+		err := d.Bazel.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if d.Exec != nil {
+		err := d.Exec.Validate()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// ContextPath returns directory used as build context
+func (d Source) ContextPath() string {
+	if len(d.Context) == 0 {
+		return d.Path
+	}
+	return filepath.Join(d.Path, d.Context)
+}
+
+// DockerfilePath returns path to Dockerfile used by Dockerfile based
+// builders (or empty string for other builders); Dockerfile location
+// is relative to build context
+func (d Source) DockerfilePath() string {
+	var file *string
+
+	switch d.Type() {
+	case SourceTypeDocker:
+		if d.Docker != nil {
+			file = d.Docker.Build.File
+		}
+	case SourceTypeBuildx:
+		file = d.Buildx.Build.File
+	case SourceTypeKubectlBuildkit:
+		file = d.KubectlBuildkit.Build.File
+	case SourceTypeKaniko:
+		file = d.Kaniko.Build.File
+	case SourceTypeBuildah:
+		file = d.Buildah.Build.File
+	default:
+		return ""
+	}
+
+	if file == nil {
+		return filepath.Join(d.ContextPath(), "Dockerfile")
+	}
+	if filepath.IsAbs(*file) {
+		return *file
+	}
+	return filepath.Join(d.ContextPath(), *file)
+}
+
+// Type returns source type used to pick a builder
+// (Docker is used if no builder options are specified)
+func (d Source) Type() string {
+	switch {
+	case d.Custom != nil:
+		return d.Custom.Builder
+	case d.Buildx != nil:
+		return SourceTypeBuildx
+	case d.Pack != nil:
+		return SourceTypePack
+	case d.KubectlBuildkit != nil:
+		return SourceTypeKubectlBuildkit
+	case d.Kaniko != nil:
+		return SourceTypeKaniko
+	case d.Buildah != nil:
+		return SourceTypeBuildah
+	case d.Ko != nil:
+		return SourceTypeKo
+	case d.Bazel != nil:
+		return SourceTypeBazel
+	case d.Exec != nil:
+		return SourceTypeExec
+	default:
+		return SourceTypeDocker
+	}
+}
+
 func (d ImageOverride) Validate() error {
 	err := d.ImageRef.Validate()
 	if err != nil {
@@ -327,7 +549,7 @@ func (d Config) WriteToFile(path string) error {
 // Equal reports whether this ImageOverride is equal to another ImageOverride.
 //   (`ImageMeta` is descriptive — not identifying — so not part of equality)
 func (d ImageOverride) Equal(other ImageOverride) bool {
-	return d.ImageRef == other.ImageRef &&
+	return d.ImageRef.Equal(other.ImageRef) &&
 		d.NewImage == other.NewImage &&
 		d.Preresolved == other.Preresolved &&
 		d.TagSelection == other.TagSelection
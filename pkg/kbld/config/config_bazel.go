@@ -3,11 +3,39 @@
 
 package config
 
+import (
+	"fmt"
+)
+
 type SourceBazelOpts struct {
 	Run SourceBazelRunOpts
+	// Build produces OCI layout (e.g. rules_oci oci_image target) or
+	// image tarball (e.g. //app:image.tar) without loading it into
+	// Docker daemon; output is pushed by kbld
+	Build *SourceBazelBuildOpts `json:"build,omitempty"`
 }
 
 type SourceBazelRunOpts struct {
-	Target     *string   `json:"target"`
+	Target *string `json:"target"`
+	// DockerHost or DockerContext select remote Docker daemon
+	// that image is loaded into
+	DockerHost    *string   `json:"dockerHost"`
+	DockerContext *string   `json:"dockerContext"`
+	RawOptions    *[]string `json:"rawOptions"`
+}
+
+type SourceBazelBuildOpts struct {
+	Target     string    `json:"target"`
 	RawOptions *[]string `json:"rawOptions"`
 }
+
+func (d SourceBazelOpts) Validate() error {
+	err := validateDockerDaemon("Bazel.Run", d.Run.DockerHost, d.Run.DockerContext)
+	if err != nil {
+		return err
+	}
+	if d.Build != nil && len(d.Build.Target) == 0 {
+		return fmt.Errorf("Expected Bazel.Build.Target to be non-empty")
+	}
+	return nil
+}
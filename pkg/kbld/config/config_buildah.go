@@ -0,0 +1,21 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+type SourceBuildahOpts struct {
+	Build SourceBuildahBuildOpts
+}
+
+type SourceBuildahBuildOpts struct {
+	// https://github.com/containers/buildah/blob/main/docs/buildah-build.1.md
+	Target    *string
+	Pull      *bool
+	NoCache   *bool `json:"noCache"`
+	File      *string
+	Platform  *string
+	BuildArgs map[string]string `json:"buildArgs,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+
+	RawOptions *[]string `json:"rawOptions"`
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+)
+
+type SourceBuildxOpts struct {
+	Build SourceBuildxBuildOpts
+}
+
+type SourceBuildxBuildOpts struct {
+	// https://docs.docker.com/engine/reference/commandline/buildx_build/
+	Target    *string
+	Platforms []string `json:"platforms,omitempty"`
+	// Name of buildx builder instance (defaults to current builder)
+	Builder   *string
+	Pull      *bool
+	NoCache   *bool `json:"noCache"`
+	File      *string
+	CacheFrom []string          `json:"cacheFrom,omitempty"`
+	CacheTo   []string          `json:"cacheTo,omitempty"`
+	Secrets   []string          `json:"secrets,omitempty"`
+	SSH       []string          `json:"ssh,omitempty"`
+	BuildArgs map[string]string `json:"buildArgs,omitempty"`
+	// Daemonless exports OCI image instead of pushing or loading it
+	// via buildx; image is pushed by kbld (requires builder with
+	// docker-container or kubernetes driver)
+	Daemonless *bool `json:"daemonless"`
+
+	RawOptions *[]string `json:"rawOptions"`
+}
+
+func (d SourceBuildxOpts) Validate() error {
+	for i, platform := range d.Build.Platforms {
+		if len(platform) == 0 {
+			return fmt.Errorf("Expected Buildx.Build.Platforms[%d] to be non-empty", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+// SourceCustomOpts selects builder registered by a program
+// that embeds kbld (builders.Add(name, ...)) and passes it options as is
+type SourceCustomOpts struct {
+	Builder string                 `json:"builder"`
+	Opts    map[string]interface{} `json:"opts,omitempty"`
+}
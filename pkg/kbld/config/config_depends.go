@@ -0,0 +1,12 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+// SourceDependency refers to an image built by another source
+// that has to be built before this source (e.g. base image)
+type SourceDependency struct {
+	Image string `json:"image"`
+	// BuildArg (if specified) receives resolved image reference
+	BuildArg string `json:"buildArg,omitempty"`
+}
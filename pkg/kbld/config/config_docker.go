@@ -3,15 +3,130 @@
 
 package config
 
+import (
+	"fmt"
+	"path/filepath"
+)
+
 type SourceDockerOpts struct {
 	Build SourceDockerBuildOpts
 }
 
 type SourceDockerBuildOpts struct {
-	Target     *string
-	Pull       *bool
-	NoCache    *bool `json:"noCache"`
-	File       *string
-	Buildkit   *bool
+	// Docker compatible CLI used for building and pushing (e.g. podman)
+	CLI *string `json:"cli"`
+	// DockerHost (e.g. ssh://user@host) or DockerContext select
+	// remote Docker daemon used for building, tagging and pushing
+	// (DockerContext is only supported by docker CLI)
+	DockerHost    *string `json:"dockerHost"`
+	DockerContext *string `json:"dockerContext"`
+	// DigestFile records pushed digest via push --digestfile
+	// (supported by podman) instead of parsing push output
+	DigestFile *bool `json:"digestFile"`
+
+	Target    *string
+	Pull      *bool
+	NoCache   *bool `json:"noCache"`
+	File      *string
+	Buildkit  *bool
+	Platform  *string
+	Network   *string
+	BuildArgs []SourceDockerBuildArg `json:"buildArgs,omitempty"`
+	Labels    map[string]string      `json:"labels,omitempty"`
+	CacheFrom []string               `json:"cacheFrom,omitempty"`
+	// Secrets and SSH enable BuildKit (DOCKER_BUILDKIT=1) since they require it
+	Secrets []SourceDockerSecret `json:"secrets,omitempty"`
+	SSH     []string             `json:"ssh,omitempty"`
+
 	RawOptions *[]string `json:"rawOptions"`
 }
+
+type SourceDockerBuildArg struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value,omitempty"`
+	// ValueFromEnv names environment variable
+	// (available to kbld) that holds the value
+	ValueFromEnv *string `json:"valueFromEnv,omitempty"`
+}
+
+type SourceDockerSecret struct {
+	ID   string `json:"id"`
+	File string `json:"file"`
+}
+
+func (d SourceDockerOpts) Validate() error {
+	build := d.Build
+
+	if build.CLI != nil && len(*build.CLI) == 0 {
+		return fmt.Errorf("Expected Docker.Build.CLI to be non-empty")
+	}
+	err := validateDockerDaemon("Docker.Build", build.DockerHost, build.DockerContext)
+	if err != nil {
+		return err
+	}
+	// Only docker CLI understands --context flag (e.g. podman uses --connection)
+	if build.CLI != nil && filepath.Base(*build.CLI) != "docker" && build.DockerContext != nil {
+		return fmt.Errorf("Expected Docker.Build.DockerContext to not be used with non-docker CLI '%s'", *build.CLI)
+	}
+	if build.Platform != nil && len(*build.Platform) == 0 {
+		return fmt.Errorf("Expected Docker.Build.Platform to be non-empty")
+	}
+	if build.Network != nil && len(*build.Network) == 0 {
+		return fmt.Errorf("Expected Docker.Build.Network to be non-empty")
+	}
+
+	for i, arg := range build.BuildArgs {
+		if len(arg.Name) == 0 {
+			return fmt.Errorf("Expected Docker.Build.BuildArgs[%d].Name to be non-empty", i)
+		}
+		if (arg.Value == nil) == (arg.ValueFromEnv == nil) {
+			return fmt.Errorf("Expected exactly one of Docker.Build.BuildArgs[%d].Value "+
+				"or Docker.Build.BuildArgs[%d].ValueFromEnv to be specified", i, i)
+		}
+		if arg.ValueFromEnv != nil && len(*arg.ValueFromEnv) == 0 {
+			return fmt.Errorf("Expected Docker.Build.BuildArgs[%d].ValueFromEnv to be non-empty", i)
+		}
+	}
+
+	for name := range build.Labels {
+		if len(name) == 0 {
+			return fmt.Errorf("Expected Docker.Build.Labels names to be non-empty")
+		}
+	}
+
+	for i, cacheFrom := range build.CacheFrom {
+		if len(cacheFrom) == 0 {
+			return fmt.Errorf("Expected Docker.Build.CacheFrom[%d] to be non-empty", i)
+		}
+	}
+
+	for i, secret := range build.Secrets {
+		if len(secret.ID) == 0 {
+			return fmt.Errorf("Expected Docker.Build.Secrets[%d].ID to be non-empty", i)
+		}
+		if len(secret.File) == 0 {
+			return fmt.Errorf("Expected Docker.Build.Secrets[%d].File to be non-empty", i)
+		}
+	}
+
+	for i, ssh := range build.SSH {
+		if len(ssh) == 0 {
+			return fmt.Errorf("Expected Docker.Build.SSH[%d] to be non-empty", i)
+		}
+	}
+
+	return nil
+}
+
+func validateDockerDaemon(path string, host, context *string) error {
+	if host != nil && len(*host) == 0 {
+		return fmt.Errorf("Expected %s.DockerHost to be non-empty", path)
+	}
+	if context != nil && len(*context) == 0 {
+		return fmt.Errorf("Expected %s.DockerContext to be non-empty", path)
+	}
+	if host != nil && context != nil {
+		return fmt.Errorf("Expected only one of %s.DockerHost or %s.DockerContext to be specified", path, path)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+func TestSourceDockerBuildOptsValidation(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	cases := []struct {
+		Description string
+		Build       ctlconf.SourceDockerBuildOpts
+		ExpectedErr string
+	}{
+		{
+			Description: "valid opts",
+			Build: ctlconf.SourceDockerBuildOpts{
+				Platform: strPtr("linux/amd64"),
+				BuildArgs: []ctlconf.SourceDockerBuildArg{
+					{Name: "VERSION", Value: strPtr("1.0")},
+					{Name: "TOKEN", ValueFromEnv: strPtr("NPM_TOKEN")},
+				},
+				Labels:  map[string]string{"team": "app"},
+				Secrets: []ctlconf.SourceDockerSecret{{ID: "npmrc", File: ".npmrc"}},
+				SSH:     []string{"default"},
+			},
+		},
+		{
+			Description: "build arg with value and value from env",
+			Build: ctlconf.SourceDockerBuildOpts{
+				BuildArgs: []ctlconf.SourceDockerBuildArg{
+					{Name: "VERSION", Value: strPtr("1.0"), ValueFromEnv: strPtr("VERSION")},
+				},
+			},
+			ExpectedErr: "Expected exactly one of Docker.Build.BuildArgs[0].Value or Docker.Build.BuildArgs[0].ValueFromEnv to be specified",
+		},
+		{
+			Description: "build arg without name",
+			Build: ctlconf.SourceDockerBuildOpts{
+				BuildArgs: []ctlconf.SourceDockerBuildArg{{Value: strPtr("1.0")}},
+			},
+			ExpectedErr: "Expected Docker.Build.BuildArgs[0].Name to be non-empty",
+		},
+		{
+			Description: "secret without file",
+			Build: ctlconf.SourceDockerBuildOpts{
+				Secrets: []ctlconf.SourceDockerSecret{{ID: "npmrc"}},
+			},
+			ExpectedErr: "Expected Docker.Build.Secrets[0].File to be non-empty",
+		},
+		{
+			Description: "empty platform",
+			Build:       ctlconf.SourceDockerBuildOpts{Platform: strPtr("")},
+			ExpectedErr: "Expected Docker.Build.Platform to be non-empty",
+		},
+		{
+			Description: "remote docker host",
+			Build:       ctlconf.SourceDockerBuildOpts{DockerHost: strPtr("ssh://builder@amd64-host")},
+		},
+		{
+			Description: "docker host and context",
+			Build: ctlconf.SourceDockerBuildOpts{
+				DockerHost:    strPtr("ssh://builder@amd64-host"),
+				DockerContext: strPtr("amd64"),
+			},
+			ExpectedErr: "Expected only one of Docker.Build.DockerHost or Docker.Build.DockerContext to be specified",
+		},
+		{
+			Description: "docker context with docker cli path",
+			Build: ctlconf.SourceDockerBuildOpts{
+				CLI:           strPtr("/usr/local/bin/docker"),
+				DockerContext: strPtr("amd64"),
+			},
+		},
+		{
+			Description: "docker context with podman cli",
+			Build: ctlconf.SourceDockerBuildOpts{
+				CLI:           strPtr("podman"),
+				DockerContext: strPtr("amd64"),
+			},
+			ExpectedErr: "Expected Docker.Build.DockerContext to not be used with non-docker CLI 'podman'",
+		},
+	}
+
+	for _, c := range cases {
+		src := ctlconf.Source{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     ".",
+			Docker:   &ctlconf.SourceDockerOpts{Build: c.Build},
+		}
+
+		err := src.Validate()
+
+		if len(c.ExpectedErr) == 0 {
+			if err != nil {
+				t.Fatalf("%s: Expected no error, but was: %s", c.Description, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("%s: Expected error, but was nil", c.Description)
+		}
+		if err.Error() != c.ExpectedErr {
+			t.Fatalf("%s: Expected error >>>%s<<< to match >>>%s<<<", c.Description, err, c.ExpectedErr)
+		}
+	}
+}
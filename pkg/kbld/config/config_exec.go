@@ -0,0 +1,66 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// SourceExecOpts runs arbitrary command (e.g. earthly, nix build)
+// in source directory and discovers built image based on result opts
+type SourceExecOpts struct {
+	Build SourceExecBuildOpts
+}
+
+type SourceExecBuildOpts struct {
+	Command string            `json:"command"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Result  SourceExecResultOpts
+}
+
+// SourceExecResultOpts specifies where to find built image.
+// Exactly one option is expected to be set. Paths are relative to source directory.
+type SourceExecResultOpts struct {
+	// Regexp with a single group matching Docker image ID (sha256:...) in stdout
+	StdoutImageIDRegexp *string `json:"stdoutImageIDRegexp"`
+	// ImagesLock with a single image pushed by the command
+	ImagesLockPath *string `json:"imagesLockPath"`
+	// OCI image layout directory containing a single image or image index
+	OCILayoutPath *string `json:"ociLayoutPath"`
+	// File containing either pushed digest reference or local Docker image reference
+	ImageRefPath *string `json:"imageRefPath"`
+}
+
+func (d SourceExecOpts) Validate() error {
+	if len(d.Build.Command) == 0 {
+		return fmt.Errorf("Expected Exec.Build.Command to be non-empty")
+	}
+
+	result := d.Build.Result
+	var numSet int
+
+	for _, opt := range []*string{result.StdoutImageIDRegexp, result.ImagesLockPath, result.OCILayoutPath, result.ImageRefPath} {
+		if opt != nil {
+			numSet++
+		}
+	}
+
+	if numSet != 1 {
+		return fmt.Errorf("Expected exactly one of Exec.Build.Result options to be specified, but found %d", numSet)
+	}
+
+	if result.StdoutImageIDRegexp != nil {
+		re, err := regexp.Compile(*result.StdoutImageIDRegexp)
+		if err != nil {
+			return fmt.Errorf("Compiling Exec.Build.Result.StdoutImageIDRegexp: %s", err)
+		}
+		if re.NumSubexp() != 1 {
+			return fmt.Errorf("Expected Exec.Build.Result.StdoutImageIDRegexp to have exactly one group, but found %d", re.NumSubexp())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+type SourceKanikoOpts struct {
+	Build SourceKanikoBuildOpts
+}
+
+type SourceKanikoBuildOpts struct {
+	// https://github.com/GoogleContainerTools/kaniko#additional-flags
+	// Path to kaniko executor binary (defaults to 'executor')
+	Executor  *string
+	Target    *string
+	File      *string
+	Platform  *string
+	BuildArgs map[string]string `json:"buildArgs,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Cache     *bool
+	CacheRepo *string `json:"cacheRepo"`
+	CacheTTL  *string `json:"cacheTTL"`
+
+	RawOptions *[]string `json:"rawOptions"`
+}
@@ -3,10 +3,57 @@
 
 package config
 
+import (
+	"fmt"
+)
+
 type SourceKoOpts struct {
 	Build SourceKoBuildOpts
 }
 
 type SourceKoBuildOpts struct {
-	RawOptions *[]string `json:"rawOptions"`
+	// Daemonless writes image tarball instead of loading it
+	// into Docker daemon; tarball is pushed by kbld
+	Daemonless *bool `json:"daemonless"`
+	// Push lets ko publish image to image destination directly
+	// (required for building multiple platforms)
+	Push      *bool    `json:"push"`
+	Platforms []string `json:"platforms,omitempty"`
+	// BaseImage overrides default base image (KO_DEFAULTBASEIMAGE)
+	BaseImage *string `json:"baseImage"`
+	// SBOM format (e.g. spdx, cyclonedx, none)
+	SBOM *string `json:"sbom"`
+	// Bare and PreserveImportPaths control naming of published images
+	// (image destination is used as is by default when pushing)
+	Bare                *bool     `json:"bare"`
+	PreserveImportPaths *bool     `json:"preserveImportPaths"`
+	RawOptions          *[]string `json:"rawOptions"`
+}
+
+func (d SourceKoOpts) Validate() error {
+	build := d.Build
+
+	push := build.Push != nil && *build.Push
+
+	if push && build.Daemonless != nil && *build.Daemonless {
+		return fmt.Errorf("Expected only one of Ko.Build.Push or Ko.Build.Daemonless to be enabled")
+	}
+	for i, platform := range build.Platforms {
+		if len(platform) == 0 {
+			return fmt.Errorf("Expected Ko.Build.Platforms[%d] to be non-empty", i)
+		}
+	}
+	if len(build.Platforms) > 1 && !push {
+		return fmt.Errorf("Expected Ko.Build.Push to be enabled when building multiple platforms")
+	}
+	if build.BaseImage != nil && len(*build.BaseImage) == 0 {
+		return fmt.Errorf("Expected Ko.Build.BaseImage to be non-empty")
+	}
+	if build.SBOM != nil && len(*build.SBOM) == 0 {
+		return fmt.Errorf("Expected Ko.Build.SBOM to be non-empty")
+	}
+	if build.Bare != nil && *build.Bare && build.PreserveImportPaths != nil && *build.PreserveImportPaths {
+		return fmt.Errorf("Expected only one of Ko.Build.Bare or Ko.Build.PreserveImportPaths to be enabled")
+	}
+	return nil
 }
@@ -13,5 +13,6 @@ type SourceKubectlBuildkitBuildOpts struct {
 	Pull       *bool
 	NoCache    *bool `json:"noCache"`
 	File       *string
-	RawOptions *[]string `json:"rawOptions"`
+	BuildArgs  map[string]string `json:"buildArgs,omitempty"`
+	RawOptions *[]string         `json:"rawOptions"`
 }
@@ -3,6 +3,10 @@
 
 package config
 
+import (
+	"fmt"
+)
+
 type SourcePackOpts struct {
 	Build SourcePackBuildOpts
 }
@@ -10,6 +14,42 @@ type SourcePackOpts struct {
 type SourcePackBuildOpts struct {
 	Builder    *string
 	Buildpacks *[]string
-	ClearCache *bool     `json:"clearCache"`
-	RawOptions *[]string `json:"rawOptions"`
+	ClearCache *bool             `json:"clearCache"`
+	Env        map[string]string `json:"env,omitempty"`
+	RunImage   *string           `json:"runImage"`
+	// CacheImage stores lifecycle cache in a registry (requires Publish)
+	CacheImage *string `json:"cacheImage"`
+	// Descriptor is a path to project descriptor (project.toml) relative to source path
+	Descriptor *string `json:"descriptor"`
+	// Publish pushes image directly to registry from lifecycle
+	// instead of saving it to Docker daemon first
+	Publish *bool `json:"publish"`
+	// DockerHost or DockerContext select remote Docker daemon used by pack
+	DockerHost    *string   `json:"dockerHost"`
+	DockerContext *string   `json:"dockerContext"`
+	RawOptions    *[]string `json:"rawOptions"`
+}
+
+func (d SourcePackOpts) Validate() error {
+	build := d.Build
+
+	err := validateDockerDaemon("Pack.Build", build.DockerHost, build.DockerContext)
+	if err != nil {
+		return err
+	}
+	if build.RunImage != nil && len(*build.RunImage) == 0 {
+		return fmt.Errorf("Expected Pack.Build.RunImage to be non-empty")
+	}
+	if build.CacheImage != nil {
+		if len(*build.CacheImage) == 0 {
+			return fmt.Errorf("Expected Pack.Build.CacheImage to be non-empty")
+		}
+		if build.Publish == nil || !*build.Publish {
+			return fmt.Errorf("Expected Pack.Build.Publish to be enabled when Pack.Build.CacheImage is specified")
+		}
+	}
+	if build.Descriptor != nil && len(*build.Descriptor) == 0 {
+		return fmt.Errorf("Expected Pack.Build.Descriptor to be non-empty")
+	}
+	return nil
 }
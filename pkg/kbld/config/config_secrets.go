@@ -0,0 +1,90 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SourceSecret is made available to Dockerfile based builds
+// (via --secret) without being part of build command line
+type SourceSecret struct {
+	ID string `json:"id"`
+	// Env names environment variable (available to kbld) that holds secret value
+	Env *string `json:"env,omitempty"`
+	// File is a path (relative to build context) to file that holds secret value
+	File *string `json:"file,omitempty"`
+}
+
+func (d SourceSecret) Validate(i int) error {
+	if len(d.ID) == 0 {
+		return fmt.Errorf("Expected Secrets[%d].ID to be non-empty", i)
+	}
+	if (d.Env == nil) == (d.File == nil) {
+		return fmt.Errorf("Expected exactly one of Secrets[%d].Env or Secrets[%d].File to be specified", i, i)
+	}
+	if d.Env != nil && len(*d.Env) == 0 {
+		return fmt.Errorf("Expected Secrets[%d].Env to be non-empty", i)
+	}
+	if d.File != nil && len(*d.File) == 0 {
+		return fmt.Errorf("Expected Secrets[%d].File to be non-empty", i)
+	}
+	return nil
+}
+
+// BuildSecrets returns source secrets together with builder specific
+// secrets (Docker.Build.Secrets and Buildx.Build.Secrets)
+func (d Source) BuildSecrets() []SourceSecret {
+	var result []SourceSecret
+	if d.Docker != nil {
+		for _, secret := range d.Docker.Build.Secrets {
+			file := secret.File
+			result = append(result, SourceSecret{ID: secret.ID, File: &file})
+		}
+	}
+	if d.Buildx != nil {
+		for _, secret := range d.Buildx.Build.Secrets {
+			if parsed, ok := parseBuildxSecret(secret); ok {
+				result = append(result, parsed)
+			}
+		}
+	}
+	return append(result, d.Secrets...)
+}
+
+// parseBuildxSecret parses --secret flag value
+// (e.g. id=token,src=token.txt or type=env,id=TOKEN)
+func parseBuildxSecret(val string) (SourceSecret, bool) {
+	var typ, id, src, env string
+
+	for _, field := range strings.Split(val, ",") {
+		pieces := strings.SplitN(field, "=", 2)
+		if len(pieces) != 2 {
+			return SourceSecret{}, false
+		}
+		switch strings.ToLower(strings.TrimSpace(pieces[0])) {
+		case "type":
+			typ = pieces[1]
+		case "id":
+			id = pieces[1]
+		case "src", "source":
+			src = pieces[1]
+		case "env":
+			env = pieces[1]
+		}
+	}
+
+	switch {
+	case len(env) > 0:
+		return SourceSecret{ID: id, Env: &env}, true
+	case len(src) > 0:
+		return SourceSecret{ID: id, File: &src}, true
+	case typ == "env" && len(id) > 0:
+		// Env variable defaults to secret ID
+		return SourceSecret{ID: id, Env: &id}, true
+	default:
+		return SourceSecret{}, false
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+func TestSourceSecretsValidation(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	cases := []struct {
+		Description string
+		Secrets     []ctlconf.SourceSecret
+		ExpectedErr string
+	}{
+		{
+			Description: "valid secrets",
+			Secrets: []ctlconf.SourceSecret{
+				{ID: "npm", Env: strPtr("NPM_TOKEN")},
+				{ID: "netrc", File: strPtr(".netrc")},
+			},
+		},
+		{
+			Description: "secret without id",
+			Secrets:     []ctlconf.SourceSecret{{Env: strPtr("NPM_TOKEN")}},
+			ExpectedErr: "Expected Secrets[0].ID to be non-empty",
+		},
+		{
+			Description: "secret with env and file",
+			Secrets:     []ctlconf.SourceSecret{{ID: "npm", Env: strPtr("NPM_TOKEN"), File: strPtr(".npmrc")}},
+			ExpectedErr: "Expected exactly one of Secrets[0].Env or Secrets[0].File to be specified",
+		},
+		{
+			Description: "secret without env or file",
+			Secrets:     []ctlconf.SourceSecret{{ID: "npm"}},
+			ExpectedErr: "Expected exactly one of Secrets[0].Env or Secrets[0].File to be specified",
+		},
+	}
+
+	for _, c := range cases {
+		src := ctlconf.Source{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     ".",
+			Secrets:  c.Secrets,
+		}
+
+		err := src.Validate()
+
+		if len(c.ExpectedErr) == 0 {
+			if err != nil {
+				t.Fatalf("%s: Expected no error, but was: %s", c.Description, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("%s: Expected error, but was nil", c.Description)
+		}
+		if err.Error() != c.ExpectedErr {
+			t.Fatalf("%s: Expected error >>>%s<<< to match >>>%s<<<", c.Description, err, c.ExpectedErr)
+		}
+	}
+}
+
+func TestSourceBuildSecretsIncludesBuilderSecrets(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	src := ctlconf.Source{
+		Secrets: []ctlconf.SourceSecret{{ID: "npm", Env: strPtr("NPM_TOKEN")}},
+		Docker: &ctlconf.SourceDockerOpts{
+			Build: ctlconf.SourceDockerBuildOpts{
+				Secrets: []ctlconf.SourceDockerSecret{{ID: "netrc", File: ".netrc"}},
+			},
+		},
+		Buildx: &ctlconf.SourceBuildxOpts{
+			Build: ctlconf.SourceBuildxBuildOpts{
+				Secrets: []string{"id=aws,src=aws.txt", "type=env,id=GH_TOKEN", "id=key,env=KEY", "invalid"},
+			},
+		},
+	}
+
+	expectedSecrets := []ctlconf.SourceSecret{
+		{ID: "netrc", File: strPtr(".netrc")},
+		{ID: "aws", File: strPtr("aws.txt")},
+		{ID: "GH_TOKEN", Env: strPtr("GH_TOKEN")},
+		{ID: "key", Env: strPtr("KEY")},
+		{ID: "npm", Env: strPtr("NPM_TOKEN")},
+	}
+
+	secrets := src.BuildSecrets()
+	if len(secrets) != len(expectedSecrets) {
+		t.Fatalf("Expected secrets >>>%#v<<< to match >>>%#v<<<", secrets, expectedSecrets)
+	}
+
+	for i, secret := range secrets {
+		expected := expectedSecrets[i]
+		if secret.ID != expected.ID || (secret.Env == nil) != (expected.Env == nil) || (secret.File == nil) != (expected.File == nil) {
+			t.Fatalf("Expected secret %d >>>%#v<<< to match >>>%#v<<<", i, secret, expected)
+		}
+		if (secret.Env != nil && *secret.Env != *expected.Env) || (secret.File != nil && *secret.File != *expected.File) {
+			t.Fatalf("Expected secret %d >>>%#v<<< to match >>>%#v<<<", i, secret, expected)
+		}
+	}
+}
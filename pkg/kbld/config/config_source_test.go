@@ -0,0 +1,93 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"testing"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+func TestSourceContextAndDockerfilePaths(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+
+	cases := []struct {
+		Description        string
+		Source             ctlconf.Source
+		ExpectedContext    string
+		ExpectedDockerfile string
+	}{
+		{
+			Description:        "defaults to path",
+			Source:             ctlconf.Source{Path: "svc/app"},
+			ExpectedContext:    "svc/app",
+			ExpectedDockerfile: "svc/app/Dockerfile",
+		},
+		{
+			Description: "relative context and file",
+			Source: ctlconf.Source{
+				Path:    "repo",
+				Context: "svc/app",
+				Docker:  &ctlconf.SourceDockerOpts{Build: ctlconf.SourceDockerBuildOpts{File: strPtr("build/Dockerfile")}},
+			},
+			ExpectedContext:    "repo/svc/app",
+			ExpectedDockerfile: "repo/svc/app/build/Dockerfile",
+		},
+		{
+			Description: "relative context and absolute file",
+			Source: ctlconf.Source{
+				Path:    "repo",
+				Context: "svc/app",
+				Kaniko:  &ctlconf.SourceKanikoOpts{Build: ctlconf.SourceKanikoBuildOpts{File: strPtr("/tmp/Dockerfile")}},
+			},
+			ExpectedContext:    "repo/svc/app",
+			ExpectedDockerfile: "/tmp/Dockerfile",
+		},
+		{
+			Description:        "non Dockerfile based builder",
+			Source:             ctlconf.Source{Path: "svc/app", Ko: &ctlconf.SourceKoOpts{}},
+			ExpectedContext:    "svc/app",
+			ExpectedDockerfile: "",
+		},
+	}
+
+	for _, c := range cases {
+		if contextPath := c.Source.ContextPath(); contextPath != c.ExpectedContext {
+			t.Fatalf("%s: Expected context >>>%s<<< to match >>>%s<<<", c.Description, contextPath, c.ExpectedContext)
+		}
+		if dockerfilePath := c.Source.DockerfilePath(); dockerfilePath != c.ExpectedDockerfile {
+			t.Fatalf("%s: Expected Dockerfile >>>%s<<< to match >>>%s<<<", c.Description, dockerfilePath, c.ExpectedDockerfile)
+		}
+	}
+}
+
+func TestSourceValidateContext(t *testing.T) {
+	cases := []struct {
+		Context     string
+		ExpectedErr string
+	}{
+		{Context: ""},
+		{Context: "svc/app"},
+		{Context: "svc/../app"},
+		{Context: "..", ExpectedErr: "Expected Context to be a relative path within Path"},
+		{Context: "../other", ExpectedErr: "Expected Context to be a relative path within Path"},
+		{Context: "svc/../../other", ExpectedErr: "Expected Context to be a relative path within Path"},
+		{Context: "/src", ExpectedErr: "Expected Context to be a relative path within Path"},
+	}
+
+	for _, c := range cases {
+		src := ctlconf.Source{ImageRef: ctlconf.ImageRef{Image: "app"}, Path: "repo", Context: c.Context}
+
+		err := src.Validate()
+		if len(c.ExpectedErr) == 0 {
+			if err != nil {
+				t.Fatalf("Expected context >>>%s<<< to be valid, but was: %s", c.Context, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != c.ExpectedErr {
+			t.Fatalf("Expected context >>>%s<<< to fail with >>>%s<<<, but was: %v", c.Context, c.ExpectedErr, err)
+		}
+	}
+}
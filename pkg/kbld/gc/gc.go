@@ -0,0 +1,166 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package gc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+var (
+	// Matches stable tags produced by Docker.RetagStable (e.g. kbld:app-sha256-...)
+	stableLocalTagRegexp = regexp.MustCompile("^(.+)-sha256-[0-9a-f]{64}$")
+)
+
+type Opts struct {
+	// Keep is number of most recent local builds kept per image
+	Keep int
+	// OlderThan additionally removes local builds created before given
+	// duration ago (0 disables age check)
+	OlderThan time.Duration
+	// RandomTagsOlderThan limits removal of temporary local tags and random
+	// registry tags to ones created before given duration ago since recent ones
+	// may still be used by builds or pushes in progress
+	RandomTagsOlderThan time.Duration
+	DryRun              bool
+}
+
+// GC removes leftovers of previous builds: stale local kbld:... images
+// and random (kbld-)rand-... tags used for pushing to registries
+type GC struct {
+	docker   ctlbdk.Docker
+	registry ctlreg.Registry
+	opts     Opts
+	logger   *ctllog.PrefixWriter
+}
+
+func NewGC(docker ctlbdk.Docker, registry ctlreg.Registry, opts Opts, logger ctllog.Logger) GC {
+	return GC{docker, registry, opts, logger.NewPrefixedWriter("gc | ")}
+}
+
+// CleanLocal removes stale images from local kbld repository and
+// returns number of removed images
+func (g GC) CleanLocal(ctx context.Context) (int, error) {
+	images, err := g.docker.LocalImages(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := g.cutoff()
+	randomTagsCutoff := g.randomTagsCutoff()
+	buildsByImage := map[string][]ctlbdk.DockerLocalImage{}
+	var stale []ctlbdk.DockerLocalImage
+
+	for _, img := range images {
+		if match := stableLocalTagRegexp.FindStringSubmatch(img.Tag); len(match) == 2 {
+			buildsByImage[match[1]] = append(buildsByImage[match[1]], img)
+			continue
+		}
+		// Temporary tags are left behind by interrupted builds;
+		// their creation time is part of the tag itself
+		if createdAt, found := (ctlb.TagBuilder{}).RandomStrTime(img.Tag); found {
+			if createdAt.Before(randomTagsCutoff) {
+				stale = append(stale, img)
+			}
+		}
+	}
+
+	for _, builds := range buildsByImage {
+		sort.SliceStable(builds, func(i, j int) bool {
+			return builds[i].CreatedAt.After(builds[j].CreatedAt)
+		})
+		for i, img := range builds {
+			if i >= g.opts.Keep || (g.opts.OlderThan > 0 && img.CreatedAt.Before(cutoff)) {
+				stale = append(stale, img)
+			}
+		}
+	}
+
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Tag < stale[j].Tag })
+
+	for _, img := range stale {
+		g.logger.WriteStr("%sremoving local image %s (created %s)\n",
+			g.dryRunPrefix(), img.Ref(), img.CreatedAt.Format(time.RFC3339))
+
+		if !g.opts.DryRun {
+			err := g.docker.RemoveImage(ctx, img.Ref())
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(stale), nil
+}
+
+// CleanRepository tags images pushed with random (kbld-)rand-... tags
+// with digest derived tag (kbld-sha256-...) and deletes random tags.
+// Returns number of deleted tags.
+func (g GC) CleanRepository(ctx context.Context, repo regname.Repository) (int, error) {
+	tags, err := g.registry.ListTags(ctx, repo)
+	if err != nil {
+		return 0, fmt.Errorf("Listing tags of '%s': %s", repo.Name(), err)
+	}
+
+	cutoff := g.randomTagsCutoff()
+	deleted := 0
+
+	for _, tag := range tags {
+		// Builders push either with kbld-rand-... or rand-...-<image> tags
+		createdAt, found := (ctlb.TagBuilder{}).RandomStrTime(strings.TrimPrefix(tag, "kbld-"))
+		if !found || !createdAt.Before(cutoff) {
+			continue
+		}
+
+		tagRef := repo.Tag(tag)
+
+		desc, err := g.registry.Generic(ctx, tagRef)
+		if err != nil {
+			return deleted, fmt.Errorf("Getting digest of '%s': %s", tagRef.Name(), err)
+		}
+
+		digestTagRef := repo.Tag(ctlb.TagBuilder{}.DigestTag(desc.Digest.String()))
+
+		g.logger.WriteStr("%sreplacing registry tag %s with %s\n",
+			g.dryRunPrefix(), tagRef.Name(), digestTagRef.TagStr())
+
+		if !g.opts.DryRun {
+			// Tag first so that pushed image does not lose all of its tags
+			err = g.registry.WriteTag(ctx, digestTagRef, repo.Digest(desc.Digest.String()))
+			if err != nil {
+				return deleted, err
+			}
+
+			err = g.registry.Delete(ctx, tagRef)
+			if err != nil {
+				return deleted, fmt.Errorf("Deleting tag '%s': %s", tagRef.Name(), err)
+			}
+		}
+
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+func (g GC) cutoff() time.Time { return time.Now().Add(-g.opts.OlderThan) }
+
+func (g GC) randomTagsCutoff() time.Time { return time.Now().Add(-g.opts.RandomTagsOlderThan) }
+
+func (g GC) dryRunPrefix() string {
+	if g.opts.DryRun {
+		return "(dry run) "
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package gc_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlgc "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/gc"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+const (
+	digest1 = "1111111111111111111111111111111111111111111111111111111111111111"
+	digest2 = "2222222222222222222222222222222222222222222222222222222222222222"
+	digest3 = "3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+func TestCleanLocalKeepsRecentBuilds(t *testing.T) {
+	now := time.Now()
+	oldTmpTag := fmt.Sprintf("rand-%d-123-app", now.Add(-48*time.Hour).UnixNano())
+	newTmpTag := fmt.Sprintf("rand-%d-123-app", now.UnixNano())
+
+	docker, rmiLogPath := newFakeDocker(t, []string{
+		localImageJSON("app-sha256-"+digest1, now.Add(-1*time.Hour)),
+		localImageJSON("app-sha256-"+digest2, now.Add(-2*time.Hour)),
+		localImageJSON("app-sha256-"+digest3, now.Add(-3*time.Hour)),
+		localImageJSON("other-sha256-"+digest1, now.Add(-72*time.Hour)),
+		localImageJSON(oldTmpTag, now),
+		localImageJSON(newTmpTag, now),
+		localImageJSON("manual", now.Add(-72*time.Hour)),
+		`{"Tag":"<none>","ID":"sha256:` + digest1 + `","CreatedAt":"bad"}`,
+	})
+
+	var buf bytes.Buffer
+	gc := ctlgc.NewGC(docker, ctlreg.Registry{}, ctlgc.Opts{Keep: 2, OlderThan: 24 * time.Hour, RandomTagsOlderThan: 24 * time.Hour}, ctllog.NewLogger(&buf))
+
+	removed, err := gc.CleanLocal(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedRemoved := []string{
+		"kbld:app-sha256-" + digest3,
+		"kbld:other-sha256-" + digest1,
+		"kbld:" + oldTmpTag,
+	}
+
+	if removed != len(expectedRemoved) {
+		t.Fatalf("Expected to remove %d images, but removed %d", len(expectedRemoved), removed)
+	}
+
+	rmiArgs := readLines(t, rmiLogPath)
+	if !reflect.DeepEqual(rmiArgs, expectedRemoved) {
+		t.Fatalf("Expected removed images >>>%#v<<< to match >>>%#v<<<", rmiArgs, expectedRemoved)
+	}
+
+	expectedOut := "gc | removing local image kbld:other-sha256-" + digest1
+	if !strings.Contains(buf.String(), expectedOut) {
+		t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedOut)
+	}
+}
+
+func TestCleanLocalDryRunDoesNotRemove(t *testing.T) {
+	docker, rmiLogPath := newFakeDocker(t, []string{
+		localImageJSON("app-sha256-"+digest1, time.Now()),
+		localImageJSON("app-sha256-"+digest2, time.Now().Add(-time.Hour)),
+	})
+
+	var buf bytes.Buffer
+	gc := ctlgc.NewGC(docker, ctlreg.Registry{}, ctlgc.Opts{Keep: 1, DryRun: true}, ctllog.NewLogger(&buf))
+
+	removed, err := gc.CleanLocal(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	if removed != 1 {
+		t.Fatalf("Expected to report 1 removed image, but was %d", removed)
+	}
+
+	if rmiArgs := readLines(t, rmiLogPath); len(rmiArgs) != 0 {
+		t.Fatalf("Expected no images to be removed, but was: %#v", rmiArgs)
+	}
+
+	expectedOut := "gc | (dry run) removing local image kbld:app-sha256-" + digest2
+	if !strings.Contains(buf.String(), expectedOut) {
+		t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", buf.String(), expectedOut)
+	}
+}
+
+func TestCleanRepositoryReplacesRandomTags(t *testing.T) {
+	host, reg := testutil.NewRegistry(t)
+	repo, err := regname.NewRepository(host + "/app")
+	if err != nil {
+		t.Fatalf("Building repository: %s", err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting image digest: %s", err)
+	}
+
+	oldTag := fmt.Sprintf("kbld-rand-%d-123", time.Now().Add(-48*time.Hour).UnixNano())
+	oldImageTag := fmt.Sprintf("rand-%d-123-app", time.Now().Add(-48*time.Hour).UnixNano())
+	newTag := fmt.Sprintf("kbld-rand-%d-123", time.Now().UnixNano())
+
+	for _, tag := range []string{oldTag, oldImageTag, newTag, "latest"} {
+		err := reg.WriteImage(context.Background(), repo.Tag(tag), img)
+		if err != nil {
+			t.Fatalf("Writing image: %s", err)
+		}
+	}
+
+	// Recent random tags are kept regardless of age of local builds
+	var buf bytes.Buffer
+	gc := ctlgc.NewGC(ctlbdk.Docker{}, reg, ctlgc.Opts{RandomTagsOlderThan: 24 * time.Hour}, ctllog.NewLogger(&buf))
+
+	deleted, err := gc.CleanRepository(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	if deleted != 2 {
+		t.Fatalf("Expected to delete 2 tags, but was %d", deleted)
+	}
+
+	tags, err := reg.ListTags(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("Listing tags: %s", err)
+	}
+
+	digestTag := "kbld-sha256-" + imgDigest.Hex
+	expectedTags := map[string]struct{}{newTag: {}, "latest": {}, digestTag: {}}
+
+	if len(tags) != len(expectedTags) {
+		t.Fatalf("Expected tags >>>%#v<<< to match >>>%#v<<<", tags, expectedTags)
+	}
+	for _, tag := range tags {
+		if _, found := expectedTags[tag]; !found {
+			t.Fatalf("Expected tags >>>%#v<<< to match >>>%#v<<<", tags, expectedTags)
+		}
+	}
+
+	desc, err := reg.Generic(context.Background(), repo.Tag(digestTag))
+	if err != nil {
+		t.Fatalf("Getting digest tag: %s", err)
+	}
+
+	if desc.Digest != imgDigest {
+		t.Fatalf("Expected digest %s to match %s", desc.Digest, imgDigest)
+	}
+}
+
+func newFakeDocker(t *testing.T, imagesOutput []string) (ctlbdk.Docker, string) {
+	dir := t.TempDir()
+	rmiLogPath := filepath.Join(dir, "rmi.log")
+	imagesPath := filepath.Join(dir, "images.json")
+
+	err := ioutil.WriteFile(imagesPath, []byte(strings.Join(imagesOutput, "\n")+"\n"), 0600)
+	if err != nil {
+		t.Fatalf("Writing images output: %s", err)
+	}
+
+	// Fake docker lists images from file and records removed images
+	script := `#!/bin/sh
+case "$1" in
+  images) cat "` + imagesPath + `" ;;
+  rmi) echo "$2" >> "` + rmiLogPath + `" ;;
+  *) echo "unexpected args: $@" >&2; exit 1 ;;
+esac
+`
+	cliPath := testutil.WriteCLI(t, "docker", script)
+
+	return ctlbdk.NewDocker(ctllog.NewLogger(&bytes.Buffer{})).WithCLI(cliPath), rmiLogPath
+}
+
+func localImageJSON(tag string, createdAt time.Time) string {
+	return fmt.Sprintf(`{"Repository":"kbld","Tag":"%s","ID":"sha256:%s","CreatedAt":"%s"}`,
+		tag, digest1, createdAt.Format("2006-01-02 15:04:05 -0700 MST"))
+}
+
+func readLines(t *testing.T, path string) []string {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		t.Fatalf("Reading %s: %s", path, err)
+	}
+	return strings.Split(strings.TrimSpace(string(bs)), "\n")
+}
@@ -0,0 +1,599 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbbz "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/bazel"
+	ctlbbh "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/buildah"
+	ctlbbx "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/buildx"
+	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
+	ctlbex "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/exec"
+	ctlbkn "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/kaniko"
+	ctlbko "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/ko"
+	ctlbkb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/kubectlbuildkit"
+	ctlboci "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/oci"
+	ctlbpk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/pack"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+// NewDefaultBuilders returns builders for all source types supported by kbld
+func NewDefaultBuilders(registry ctlreg.Registry, logger ctllog.Logger) *ctlb.Builders {
+	docker := ctlbdk.NewDocker(logger)
+	ociPusher := ctlboci.NewPusher(registry, logger)
+
+	builders := ctlb.NewBuilders()
+	builders.Add(ctlconf.SourceTypeDocker, dockerBuilder{docker, ociPusher})
+	builders.Add(ctlconf.SourceTypeBuildx, buildxBuilder{ctlbbx.NewBuildx(docker, logger), ociPusher})
+	builders.Add(ctlconf.SourceTypePack, packBuilder{ctlbpk.NewPack(docker, logger), docker, ociPusher})
+	builders.Add(ctlconf.SourceTypeKubectlBuildkit, kubectlBuildkitBuilder{ctlbkb.NewKubectlBuildkit(logger)})
+	builders.Add(ctlconf.SourceTypeKaniko, kanikoBuilder{ctlbkn.NewKaniko(logger), registry})
+	builders.Add(ctlconf.SourceTypeBuildah, buildahBuilder{ctlbbh.NewBuildah(logger), registry})
+	builders.Add(ctlconf.SourceTypeKo, koBuilder{ctlbko.NewKo(logger), docker, ociPusher})
+	builders.Add(ctlconf.SourceTypeBazel, bazelBuilder{ctlbbz.NewBazel(docker, logger), docker, ociPusher})
+	builders.Add(ctlconf.SourceTypeExec, execBuilder{ctlbex.NewExec(docker, logger), docker, ociPusher})
+	return builders
+}
+
+type dockerBuilder struct {
+	docker    ctlbdk.Docker
+	ociPusher ctlboci.Pusher
+}
+
+var _ ctlb.Builder = dockerBuilder{}
+
+func (b dockerBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	if src.Docker == nil {
+		src.Docker = &ctlconf.SourceDockerOpts{}
+	}
+
+	opts := ctlbdk.DockerBuildOpts{
+		Target:     src.Docker.Build.Target,
+		Pull:       src.Docker.Build.Pull,
+		NoCache:    src.Docker.Build.NoCache,
+		File:       src.Docker.Build.File,
+		Buildkit:   src.Docker.Build.Buildkit,
+		Platform:   src.Docker.Build.Platform,
+		Network:    src.Docker.Build.Network,
+		BuildArgs:  dockerBuildArgs(ctx, src.Docker.Build.BuildArgs),
+		Labels:     ctlb.MergeLabels(ctx, src.Docker.Build.Labels),
+		CacheFrom:  src.Docker.Build.CacheFrom,
+		Secrets:    src.BuildSecrets(),
+		SSH:        src.Docker.Build.SSH,
+		RawOptions: src.Docker.Build.RawOptions,
+	}
+
+	docker := b.docker.WithDaemon(ctlbdk.DockerDaemon{
+		Host:    src.Docker.Build.DockerHost,
+		Context: src.Docker.Build.DockerContext,
+	})
+	if src.Docker.Build.CLI != nil {
+		docker = docker.WithCLI(*src.Docker.Build.CLI)
+	}
+	if src.Docker.Build.DigestFile != nil {
+		docker = docker.WithDigestFile(*src.Docker.Build.DigestFile)
+	}
+
+	dockerTmpRef, err := docker.Build(ctx, image, src.ContextPath(), opts)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return optionalPushWithDocker(ctx, image, docker, b.ociPusher, dockerTmpRef, imgDst)
+}
+
+// dockerBuildArgs adds build args from context (e.g. resolved dependencies)
+// unless they were explicitly configured
+func dockerBuildArgs(ctx context.Context, buildArgs []ctlconf.SourceDockerBuildArg) []ctlconf.SourceDockerBuildArg {
+	ctxBuildArgs := ctlb.BuildArgsFromContext(ctx)
+	if len(ctxBuildArgs) == 0 {
+		return buildArgs
+	}
+
+	configured := map[string]struct{}{}
+	for _, arg := range buildArgs {
+		configured[arg.Name] = struct{}{}
+	}
+
+	var names []string
+	for name := range ctxBuildArgs {
+		if _, found := configured[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var result []ctlconf.SourceDockerBuildArg
+	for _, name := range names {
+		val := ctxBuildArgs[name]
+		result = append(result, ctlconf.SourceDockerBuildArg{Name: name, Value: &val})
+	}
+	return append(result, buildArgs...)
+}
+
+func secretSpecs(secrets []ctlconf.SourceSecret) []string {
+	var result []string
+	for _, secret := range secrets {
+		result = append(result, ctlb.SecretSpec(secret))
+	}
+	return result
+}
+
+type buildxBuilder struct {
+	buildx    ctlbbx.Buildx
+	ociPusher ctlboci.Pusher
+}
+
+var _ ctlb.Builder = buildxBuilder{}
+
+func (b buildxBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	opts := src.Buildx.Build
+	opts.Secrets = append(append([]string{}, opts.Secrets...), secretSpecs(src.Secrets)...)
+	opts.BuildArgs = ctlb.MergeBuildArgs(ctx, opts.BuildArgs)
+
+	if opts.Daemonless != nil && *opts.Daemonless {
+		return buildAndPushWithRegistry(ctx, image, "image.tar", imgDst, func(tarballPath string) error {
+			return b.buildx.BuildOCITarball(ctx, image, src.ContextPath(), tarballPath, opts)
+		}, b.ociPusher.PushLayoutTarball)
+	}
+
+	err := checkNoDigestTag(src, imgDst)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	url, err := b.buildx.BuildAndPush(ctx, image, src.ContextPath(), imgDst, opts)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return ctlb.BuildResult{URL: url}, nil
+}
+
+type packBuilder struct {
+	pack      ctlbpk.Pack
+	docker    ctlbdk.Docker
+	ociPusher ctlboci.Pusher
+}
+
+var _ ctlb.Builder = packBuilder{}
+
+func (b packBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	// Provenance labels are only applied if builder includes image labels
+	// buildpack; explicitly configured env takes precedence over them
+	env := packProvenanceEnv(ctlb.LabelsFromContext(ctx))
+	for k, v := range src.Pack.Build.Env {
+		env[k] = v
+	}
+
+	opts := ctlbpk.PackBuildOpts{
+		Builder:    src.Pack.Build.Builder,
+		Buildpacks: src.Pack.Build.Buildpacks,
+		ClearCache: src.Pack.Build.ClearCache,
+		Env:        env,
+		RunImage:   src.Pack.Build.RunImage,
+		CacheImage: src.Pack.Build.CacheImage,
+		Descriptor: src.Pack.Build.Descriptor,
+		RawOptions: src.Pack.Build.RawOptions,
+	}
+
+	daemon := ctlbdk.DockerDaemon{Host: src.Pack.Build.DockerHost, Context: src.Pack.Build.DockerContext}
+	pack := b.pack.WithDaemon(daemon)
+
+	if src.Pack.Build.Publish != nil && *src.Pack.Build.Publish {
+		if imgDst == nil {
+			return ctlb.BuildResult{}, fmt.Errorf("Expected image destination to be specified when publishing with pack")
+		}
+
+		err := checkNoDigestTag(src, imgDst)
+		if err != nil {
+			return ctlb.BuildResult{}, err
+		}
+
+		digestRef, err := pack.BuildAndPublish(ctx, image, src.ContextPath(), imgDst.NewImage, opts)
+		if err != nil {
+			return ctlb.BuildResult{}, err
+		}
+
+		return ctlb.BuildResult{URL: digestRef.Name()}, nil
+	}
+
+	dockerTmpRef, err := pack.Build(ctx, image, src.ContextPath(), opts)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return optionalPushWithDocker(ctx, image, b.docker.WithDaemon(daemon), b.ociPusher, dockerTmpRef, imgDst)
+}
+
+// packProvenanceEnv maps labels to env variables understood by
+// image labels buildpack (https://github.com/paketo-buildpacks/image-labels)
+func packProvenanceEnv(labels map[string]string) map[string]string {
+	envNames := map[string]string{
+		ctlb.LabelCreated:  "BP_OCI_CREATED",
+		ctlb.LabelSource:   "BP_OCI_SOURCE",
+		ctlb.LabelVersion:  "BP_OCI_VERSION",
+		ctlb.LabelRevision: "BP_OCI_REVISION",
+	}
+
+	result := map[string]string{}
+	for label, val := range labels {
+		if envName, found := envNames[label]; found {
+			result[envName] = val
+		}
+	}
+	return result
+}
+
+type kubectlBuildkitBuilder struct {
+	kubectlBuildkit ctlbkb.KubectlBuildkit
+}
+
+var _ ctlb.Builder = kubectlBuildkitBuilder{}
+
+func (b kubectlBuildkitBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	opts := *src.KubectlBuildkit
+	opts.Build.BuildArgs = ctlb.MergeBuildArgs(ctx, opts.Build.BuildArgs)
+
+	err := checkNoDigestTag(src, imgDst)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	url, err := b.kubectlBuildkit.BuildAndPush(ctx, image, src.ContextPath(), imgDst, opts, src.Secrets)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return ctlb.BuildResult{URL: url}, nil
+}
+
+type kanikoBuilder struct {
+	kaniko   ctlbkn.Kaniko
+	registry ctlreg.Registry
+}
+
+var _ ctlb.Builder = kanikoBuilder{}
+
+func (b kanikoBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	opts := src.Kaniko.Build
+	opts.BuildArgs = ctlb.MergeBuildArgs(ctx, opts.BuildArgs)
+	opts.Labels = ctlb.MergeLabels(ctx, opts.Labels)
+
+	url, err := b.kaniko.BuildAndPush(ctx, image, src.ContextPath(), imgDst, opts)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	err = writeDigestTag(ctx, b.registry, url, imgDst)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return ctlb.BuildResult{URL: url}, nil
+}
+
+type buildahBuilder struct {
+	buildah  ctlbbh.Buildah
+	registry ctlreg.Registry
+}
+
+var _ ctlb.Builder = buildahBuilder{}
+
+func (b buildahBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	opts := src.Buildah.Build
+	opts.BuildArgs = ctlb.MergeBuildArgs(ctx, opts.BuildArgs)
+	opts.Labels = ctlb.MergeLabels(ctx, opts.Labels)
+
+	url, err := b.buildah.BuildAndPush(ctx, image, src.ContextPath(), imgDst, opts, src.Secrets)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	err = writeDigestTag(ctx, b.registry, url, imgDst)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return ctlb.BuildResult{URL: url}, nil
+}
+
+type koBuilder struct {
+	ko        ctlbko.Ko
+	docker    ctlbdk.Docker
+	ociPusher ctlboci.Pusher
+}
+
+var _ ctlb.Builder = koBuilder{}
+
+func (b koBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	err := checkNoLabels(ctx, src)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	if src.Ko.Build.Daemonless != nil && *src.Ko.Build.Daemonless {
+		return buildAndPushWithRegistry(ctx, image, "image.tar", imgDst, func(tarballPath string) error {
+			return b.ko.BuildTarball(ctx, image, src.ContextPath(), tarballPath, src.Ko.Build)
+		}, b.ociPusher.PushTarball)
+	}
+
+	if src.Ko.Build.Push != nil && *src.Ko.Build.Push {
+		if imgDst == nil {
+			return ctlb.BuildResult{}, fmt.Errorf("Expected image destination to be specified when pushing with ko")
+		}
+
+		err := checkNoDigestTag(src, imgDst)
+		if err != nil {
+			return ctlb.BuildResult{}, err
+		}
+
+		digestRef, err := b.ko.BuildAndPush(ctx, image, src.ContextPath(), imgDst.NewImage, src.Ko.Build)
+		if err != nil {
+			return ctlb.BuildResult{}, err
+		}
+
+		return ctlb.BuildResult{URL: digestRef.Name()}, nil
+	}
+
+	dockerTmpRef, err := b.ko.Build(ctx, image, src.ContextPath(), src.Ko.Build)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return optionalPushWithDocker(ctx, image, b.docker, b.ociPusher, dockerTmpRef, imgDst)
+}
+
+type bazelBuilder struct {
+	bazel     ctlbbz.Bazel
+	docker    ctlbdk.Docker
+	ociPusher ctlboci.Pusher
+}
+
+var _ ctlb.Builder = bazelBuilder{}
+
+func (b bazelBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	err := checkNoLabels(ctx, src)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	if src.Bazel.Build != nil {
+		if imgDst == nil {
+			return ctlb.BuildResult{}, fmt.Errorf("Expected image destination to be specified to push image built by bazel")
+		}
+
+		output, err := b.bazel.Build(ctx, image, src.ContextPath(), *src.Bazel.Build)
+		if err != nil {
+			return ctlb.BuildResult{}, err
+		}
+
+		if output.OCILayout {
+			return pushWithRegistry(ctx, image, output.Path, imgDst, b.ociPusher.PushLayout)
+		}
+
+		return pushWithRegistry(ctx, image, output.Path, imgDst, b.ociPusher.PushTarball)
+	}
+
+	daemon := ctlbdk.DockerDaemon{Host: src.Bazel.Run.DockerHost, Context: src.Bazel.Run.DockerContext}
+	bazel := b.bazel.WithDaemon(daemon)
+
+	dockerTmpRef, err := bazel.Run(ctx, image, src.ContextPath(), src.Bazel.Run)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return optionalPushWithDocker(ctx, image, b.docker.WithDaemon(daemon), b.ociPusher, dockerTmpRef, imgDst)
+}
+
+type execBuilder struct {
+	exec      ctlbex.Exec
+	docker    ctlbdk.Docker
+	ociPusher ctlboci.Pusher
+}
+
+var _ ctlb.Builder = execBuilder{}
+
+func (b execBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	err := checkNoLabels(ctx, src)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	var imageDst string
+	if imgDst != nil {
+		imageDst = imgDst.NewImage
+	}
+
+	result, err := b.exec.Build(ctx, image, src.ContextPath(), imageDst, src.Exec.Build)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	switch {
+	case result.DockerTmpRef != nil:
+		return optionalPushWithDocker(ctx, image, b.docker, b.ociPusher, *result.DockerTmpRef, imgDst)
+
+	case result.DigestRef != nil:
+		// Command is responsible for pushing image to its destination
+		return ctlb.BuildResult{URL: result.DigestRef.Name()}, nil
+
+	case len(result.OCILayoutPath) > 0:
+		if imgDst == nil {
+			return ctlb.BuildResult{}, fmt.Errorf("Expected image destination to be specified to push OCI layout")
+		}
+
+		return pushWithRegistry(ctx, image, result.OCILayoutPath, imgDst, b.ociPusher.PushLayout)
+
+	default:
+		return ctlb.BuildResult{}, fmt.Errorf("Expected exec builder to return image location, but it did not")
+	}
+}
+
+// checkNoLabels errs for builders that cannot add labels to built images
+// so that requested provenance labels are not silently dropped
+func checkNoLabels(ctx context.Context, src ctlconf.Source) error {
+	if len(ctlb.LabelsFromContext(ctx)) > 0 {
+		return fmt.Errorf("Expected provenance labels to not be requested since %s builder does not support adding labels", src.Type())
+	}
+	return nil
+}
+
+// checkNoDigestTag errs for builders that push images themselves
+// since digest is not known until image is pushed
+func checkNoDigestTag(src ctlconf.Source, imgDst *ctlconf.ImageDestination) error {
+	if imgDst == nil || !imgDst.DigestTag {
+		return nil
+	}
+	if builderName, found := selfPushingBuilder(src); found {
+		return fmt.Errorf("Expected destination '%s' to not use digestTag since %s pushes images with random tags itself",
+			imgDst.NewImage, builderName)
+	}
+	return nil
+}
+
+// selfPushingBuilder returns name of the builder (if any)
+// that pushes images itself for given source
+func selfPushingBuilder(src ctlconf.Source) (string, bool) {
+	isTrue := func(val *bool) bool { return val != nil && *val }
+
+	if src.Custom != nil {
+		return "", false
+	}
+
+	switch src.Type() {
+	case ctlconf.SourceTypeBuildx:
+		return "buildx", !isTrue(src.Buildx.Build.Daemonless)
+	case ctlconf.SourceTypePack:
+		return "pack (with publish)", isTrue(src.Pack.Build.Publish)
+	case ctlconf.SourceTypeKubectlBuildkit:
+		return "kubectl-buildkit", true
+	case ctlconf.SourceTypeKo:
+		return "ko (with push)", !isTrue(src.Ko.Build.Daemonless) && isTrue(src.Ko.Build.Push)
+	default:
+		return "", false
+	}
+}
+
+// writeDigestTag additionally tags image pushed with random tag
+// with digest derived tag (kbld-sha256-...) if destination requests it
+func writeDigestTag(ctx context.Context, registry ctlreg.Registry, url string, imgDst *ctlconf.ImageDestination) error {
+	if imgDst == nil || !imgDst.DigestTag {
+		return nil
+	}
+
+	digestRef, err := regname.NewDigest(url, regname.WeakValidation)
+	if err != nil {
+		return fmt.Errorf("Parsing pushed image ref '%s': %s", url, err)
+	}
+
+	tagRef := digestRef.Context().Tag(ctlb.TagBuilder{}.DigestTag(digestRef.DigestStr()))
+
+	err = registry.WriteTag(ctx, tagRef, digestRef)
+	if err != nil {
+		return fmt.Errorf("Tagging pushed image '%s': %s", url, err)
+	}
+
+	return nil
+}
+
+func optionalPushWithDocker(ctx context.Context, image string, docker ctlbdk.Docker, ociPusher ctlboci.Pusher,
+	dockerTmpRef ctlbdk.DockerTmpRef, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	if imgDst != nil && imgDst.DigestTag {
+		// Digest is only known upfront once image is exported from Docker daemon
+		return buildAndPushWithRegistry(ctx, image, "image.tar", imgDst, func(tarballPath string) error {
+			return docker.Save(ctx, image, dockerTmpRef, tarballPath)
+		}, ociPusher.PushTarball)
+	}
+
+	if imgDst != nil {
+		digest, err := docker.Push(ctx, image, dockerTmpRef, imgDst.NewImage)
+		if err != nil {
+			return ctlb.BuildResult{}, err
+		}
+
+		url, origins, err := NewDigestedImageFromParts(imgDst.NewImage, digest.AsString()).URL(ctx)
+		if err != nil {
+			return ctlb.BuildResult{}, err
+		}
+
+		return ctlb.BuildResult{URL: url, Origins: origins}, nil
+	}
+
+	return ctlb.BuildResult{URL: dockerTmpRef.AsString()}, nil
+}
+
+type registryPushFunc func(ctx context.Context, image, path, imageDst string) (regname.Digest, error)
+
+// buildAndPushWithRegistry builds image into a file within tmp directory
+// and pushes it without involving Docker daemon
+func buildAndPushWithRegistry(ctx context.Context, image, fileName string, imgDst *ctlconf.ImageDestination,
+	buildFunc func(path string) error, pushFunc registryPushFunc) (ctlb.BuildResult, error) {
+
+	if imgDst == nil {
+		return ctlb.BuildResult{}, fmt.Errorf("Expected image destination to be specified when building without Docker daemon")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "kbld-build")
+	if err != nil {
+		return ctlb.BuildResult{}, fmt.Errorf("Creating tmp dir for build output: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, fileName)
+
+	err = buildFunc(path)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return pushWithRegistry(ctx, image, path, imgDst, pushFunc)
+}
+
+func pushWithRegistry(ctx context.Context, image, path string,
+	imgDst *ctlconf.ImageDestination, pushFunc registryPushFunc) (ctlb.BuildResult, error) {
+
+	digestRef, err := pushFunc(ctx, image, path, imgDst.NewImage)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	url, origins, err := NewDigestedImageFromParts(imgDst.NewImage, digestRef.DigestStr()).URL(ctx)
+	if err != nil {
+		return ctlb.BuildResult{}, err
+	}
+
+	return ctlb.BuildResult{URL: url, Origins: origins}, nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctlimg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/image"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+func TestDockerBuilderPushesWithDigestTag(t *testing.T) {
+	host, reg := testutil.NewRegistry(t)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting image digest: %s", err)
+	}
+
+	tarballPath := filepath.Join(t.TempDir(), "image.tar")
+
+	err = tarball.WriteToFile(tarballPath, nil, img)
+	if err != nil {
+		t.Fatalf("Writing image tarball: %s", err)
+	}
+
+	// Fake docker builds by writing --iidfile and saves prebuilt tarball
+	script := `#!/bin/sh
+case "$1" in
+  build)
+    while [ $# -gt 0 ]; do
+      case "$1" in
+        --iidfile) echo "sha256:aa1fce99c57c864cc8d98f7ff4a54bc3b9b7e3f63a741de926a3393bc76f5986" > "$2"; shift ;;
+      esac
+      shift
+    done ;;
+  save) cp "` + tarballPath + `" "$3" ;;
+  tag|rmi) ;;
+  *) echo "unexpected args: $@" >&2; exit 1 ;;
+esac
+`
+	testutil.InstallCLI(t, "docker", script)
+
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     t.TempDir(),
+		}},
+		Destinations: []ctlconf.ImageDestination{{
+			ImageRef:  ctlconf.ImageRef{Image: "app"},
+			NewImage:  host + "/app",
+			DigestTag: true,
+		}},
+	})
+
+	expectedURL := host + "/app@" + imgDigest.String()
+
+	// Repeated pushes of the same image should not produce new tags
+	for i := 0; i < 2; i++ {
+		logger := ctllog.NewLogger(&bytes.Buffer{})
+		opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: ctlimg.NewDefaultBuilders(reg, logger)}
+		factory := ctlimg.NewFactory(opts, reg, logger)
+
+		url, _, err := factory.New("app").URL(context.Background())
+		if err != nil {
+			t.Fatalf("Expected no error, but was: %s", err)
+		}
+
+		if url != expectedURL {
+			t.Fatalf("Expected url >>>%s<<< to match >>>%s<<<", url, expectedURL)
+		}
+	}
+
+	repo, err := regname.NewRepository(host + "/app")
+	if err != nil {
+		t.Fatalf("Building repository: %s", err)
+	}
+
+	tags, err := reg.ListTags(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("Listing tags: %s", err)
+	}
+
+	expectedTags := []string{"kbld-sha256-" + imgDigest.Hex}
+	if strings.Join(tags, ",") != strings.Join(expectedTags, ",") {
+		t.Fatalf("Expected tags >>>%#v<<< to match >>>%#v<<<", tags, expectedTags)
+	}
+}
+
+func TestKanikoBuilderAddsDigestTagAfterPush(t *testing.T) {
+	host, reg := testutil.NewRegistry(t)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Getting image digest: %s", err)
+	}
+
+	repo, err := regname.NewRepository(host + "/app")
+	if err != nil {
+		t.Fatalf("Building repository: %s", err)
+	}
+
+	// Image is pushed upfront since fake executor only writes digest file
+	err = reg.WriteImage(context.Background(), repo.Tag("kbld-rand-1"), img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	script := `#!/bin/sh
+for last; do true; done
+echo "` + imgDigest.String() + `" > "$last"
+`
+	executorPath := testutil.WriteCLI(t, "executor", script)
+
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     t.TempDir(),
+			Kaniko:   &ctlconf.SourceKanikoOpts{Build: ctlconf.SourceKanikoBuildOpts{Executor: &executorPath}},
+		}},
+		Destinations: []ctlconf.ImageDestination{{
+			ImageRef:  ctlconf.ImageRef{Image: "app"},
+			NewImage:  host + "/app",
+			DigestTag: true,
+		}},
+	})
+
+	logger := ctllog.NewLogger(&bytes.Buffer{})
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: ctlimg.NewDefaultBuilders(reg, logger)}
+	factory := ctlimg.NewFactory(opts, reg, logger)
+
+	url, _, err := factory.New("app").URL(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedURL := host + "/app@" + imgDigest.String()
+	if url != expectedURL {
+		t.Fatalf("Expected url >>>%s<<< to match >>>%s<<<", url, expectedURL)
+	}
+
+	desc, err := reg.Generic(context.Background(), repo.Tag("kbld-sha256-"+imgDigest.Hex))
+	if err != nil {
+		t.Fatalf("Getting digest tag: %s", err)
+	}
+
+	if desc.Digest != imgDigest {
+		t.Fatalf("Expected digest %s to match %s", desc.Digest, imgDigest)
+	}
+}
+
+func TestSelfPushingBuilderErrsForDigestTag(t *testing.T) {
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef:        ctlconf.ImageRef{Image: "app"},
+			Path:            t.TempDir(),
+			KubectlBuildkit: &ctlconf.SourceKubectlBuildkitOpts{},
+		}},
+		Destinations: []ctlconf.ImageDestination{{
+			ImageRef:  ctlconf.ImageRef{Image: "app"},
+			NewImage:  "registry.io/app",
+			DigestTag: true,
+		}},
+	})
+
+	logger := ctllog.NewLogger(&bytes.Buffer{})
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: ctlimg.NewDefaultBuilders(ctlreg.Registry{}, logger)}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, logger)
+
+	_, _, err := factory.New("app").URL(context.Background())
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected destination 'registry.io/app' to not use digestTag since kubectl-buildkit pushes images with random tags itself"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+}
+
+func TestBuilderWithoutLabelsSupportErrsForProvenanceLabels(t *testing.T) {
+	srcPath := t.TempDir()
+
+	runCmd(t, "git", []string{"init", "."}, srcPath)
+	runCmd(t, "git", []string{"commit", "-am", "msg1", "--allow-empty"}, srcPath)
+
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     srcPath,
+			Ko:       &ctlconf.SourceKoOpts{},
+		}},
+	})
+
+	logger := ctllog.NewLogger(&bytes.Buffer{})
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, ProvenanceLabels: true,
+		Builders: ctlimg.NewDefaultBuilders(ctlreg.Registry{}, logger)}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, logger)
+
+	_, _, err := factory.New("app").URL(context.Background())
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected provenance labels to not be requested since ko builder does not support adding labels"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+}
@@ -4,118 +4,85 @@
 package image
 
 import (
+	"context"
+	"fmt"
 	"path/filepath"
 
-	ctlbbz "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/bazel"
-	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
-	ctlbko "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/ko"
-	ctlbkb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/kubectlbuildkit"
-	ctlbpk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/pack"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbin "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/inputs"
 	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 )
 
 type BuiltImage struct {
-	url         string
-	buildSource ctlconf.Source
-	imgDst      *ctlconf.ImageDestination
-
-	docker          ctlbdk.Docker
-	pack            ctlbpk.Pack
-	kubectlBuildkit ctlbkb.KubectlBuildkit
-	ko              ctlbko.Ko
-	bazel           ctlbbz.Bazel
+	url              string
+	buildSource      ctlconf.Source
+	imgDst           *ctlconf.ImageDestination
+	dependencies     []BuiltImageDependency
+	builder          ctlb.Builder
+	provenanceLabels bool
+}
+
+// BuiltImageDependency is an image that has to be resolved before building
+type BuiltImageDependency struct {
+	URL      string
+	BuildArg string
+	Image    Image
 }
 
 func NewBuiltImage(url string, buildSource ctlconf.Source, imgDst *ctlconf.ImageDestination,
-	docker ctlbdk.Docker, pack ctlbpk.Pack, kubectlBuildkit ctlbkb.KubectlBuildkit, ko ctlbko.Ko, bazel ctlbbz.Bazel) BuiltImage {
+	dependencies []BuiltImageDependency, builder ctlb.Builder, provenanceLabels bool) BuiltImage {
 
-	return BuiltImage{url, buildSource, imgDst, docker, pack, kubectlBuildkit, ko, bazel}
+	return BuiltImage{url, buildSource, imgDst, dependencies, builder, provenanceLabels}
 }
 
-func (i BuiltImage) URL() (string, []ctlconf.Origin, error) {
+func (i BuiltImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
 	origins, err := i.sources()
 	if err != nil {
 		return "", nil, err
 	}
 
-	urlRepo, _ := URLRepo(i.url)
-
-	switch {
-	case i.buildSource.Pack != nil:
-		opts := ctlbpk.PackBuildOpts{
-			Builder:    i.buildSource.Pack.Build.Builder,
-			Buildpacks: i.buildSource.Pack.Build.Buildpacks,
-			ClearCache: i.buildSource.Pack.Build.ClearCache,
-			RawOptions: i.buildSource.Pack.Build.RawOptions,
-		}
-
-		dockerTmpRef, err := i.pack.Build(urlRepo, i.buildSource.Path, opts)
-		if err != nil {
-			return "", nil, err
-		}
-
-		return i.optionalPushWithDocker(dockerTmpRef, origins)
-
-	case i.buildSource.KubectlBuildkit != nil:
-		url, err := i.kubectlBuildkit.BuildAndPush(
-			urlRepo, i.buildSource.Path, i.imgDst, *i.buildSource.KubectlBuildkit)
-		return url, origins, err
-
-	case i.buildSource.Ko != nil:
-		dockerTmpRef, err := i.ko.Build(urlRepo, i.buildSource.Path, i.buildSource.Ko.Build)
-		if err != nil {
-			return "", nil, err
-		}
-
-		return i.optionalPushWithDocker(dockerTmpRef, origins)
-
-	case i.buildSource.Bazel != nil:
-		dockerTmpRef, err := i.bazel.Run(urlRepo, i.buildSource.Path, i.buildSource.Bazel.Run)
+	if i.provenanceLabels {
+		labels, err := i.provenance(origins)
 		if err != nil {
 			return "", nil, err
 		}
+		ctx = ctlb.WithLabels(ctx, labels)
+	}
 
-		return i.optionalPushWithDocker(dockerTmpRef, origins)
-
-	default:
-		if i.buildSource.Docker == nil {
-			i.buildSource.Docker = &ctlconf.SourceDockerOpts{}
-		}
-
-		opts := ctlbdk.DockerBuildOpts{
-			Target:     i.buildSource.Docker.Build.Target,
-			Pull:       i.buildSource.Docker.Build.Pull,
-			NoCache:    i.buildSource.Docker.Build.NoCache,
-			File:       i.buildSource.Docker.Build.File,
-			Buildkit:   i.buildSource.Docker.Build.Buildkit,
-			RawOptions: i.buildSource.Docker.Build.RawOptions,
-		}
-
-		dockerTmpRef, err := i.docker.Build(urlRepo, i.buildSource.Path, opts)
-		if err != nil {
-			return "", nil, err
-		}
+	buildArgs, err := i.resolveDependencies(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(buildArgs) > 0 {
+		ctx = ctlb.WithBuildArgs(ctx, buildArgs)
+	}
 
-		return i.optionalPushWithDocker(dockerTmpRef, origins)
+	// Full URL identifies image in logs (images of the same
+	// repository with different tags are built separately)
+	result, err := i.builder.Build(ctx, i.url, i.buildSource, i.imgDst)
+	if err != nil {
+		return "", nil, err
 	}
+
+	return result.URL, append(origins, result.Origins...), nil
 }
 
-func (i BuiltImage) optionalPushWithDocker(dockerTmpRef ctlbdk.DockerTmpRef, origins []ctlconf.Origin) (string, []ctlconf.Origin, error) {
-	if i.imgDst != nil {
-		digest, err := i.docker.Push(dockerTmpRef, i.imgDst.NewImage)
-		if err != nil {
-			return "", nil, err
-		}
+// resolveDependencies builds (or resolves) dependencies and returns
+// build args that should point to their resolved references
+func (i BuiltImage) resolveDependencies(ctx context.Context) (map[string]string, error) {
+	buildArgs := map[string]string{}
 
-		url, moreOrigins, err := NewDigestedImageFromParts(i.imgDst.NewImage, digest.AsString()).URL()
+	for _, dep := range i.dependencies {
+		url, _, err := dep.Image.URL(ctx)
 		if err != nil {
-			return "", nil, err
+			return nil, fmt.Errorf("Resolving dependency '%s': %s", dep.URL, err)
+		}
+		if len(dep.BuildArg) > 0 {
+			buildArgs[dep.BuildArg] = url
 		}
-
-		return url, append(origins, moreOrigins...), nil
 	}
 
-	return dockerTmpRef.AsString(), origins, nil
+	return buildArgs, nil
 }
 
 func (i BuiltImage) sources() ([]ctlconf.Origin, error) {
@@ -145,7 +112,7 @@ func (i BuiltImage) sources() ([]ctlconf.Origin, error) {
 			return nil, err
 		}
 
-		git.Dirty, err = gitRepo.IsDirty()
+		git.Dirty, err = i.isDirty(gitRepo)
 		if err != nil {
 			return nil, err
 		}
@@ -160,3 +127,48 @@ func (i BuiltImage) sources() ([]ctlconf.Origin, error) {
 
 	return sources, nil
 }
+
+func (i BuiltImage) isDirty(gitRepo GitRepo) (bool, error) {
+	src := i.buildSource
+
+	// Consider changes anywhere in the repo unless inputs were narrowed down
+	if len(src.WatchPaths) == 0 && len(src.Include) == 0 && len(src.Exclude) == 0 {
+		return gitRepo.IsDirty()
+	}
+
+	srcInputs, err := ctlbin.NewInputs(src)
+	if err != nil {
+		return false, err
+	}
+
+	return gitRepo.IsDirtyInputs(srcInputs)
+}
+
+// provenance returns OCI labels that link built image to its git commit
+func (i BuiltImage) provenance(origins []ctlconf.Origin) (map[string]string, error) {
+	labels := map[string]string{}
+
+	for _, origin := range origins {
+		if origin.Git == nil || origin.Git.SHA == GitRepoHeadSHANoCommits {
+			continue
+		}
+
+		labels[ctlb.LabelRevision] = origin.Git.SHA
+
+		if origin.Git.RemoteURL != GitRepoRemoteURLUnknown {
+			labels[ctlb.LabelSource] = origin.Git.RemoteURL
+		}
+		if len(origin.Git.Tags) > 0 {
+			labels[ctlb.LabelVersion] = origin.Git.Tags[0]
+		}
+
+		// Commit time (instead of current time) keeps builds reproducible
+		created, err := NewGitRepo(i.buildSource.Path).HeadCommitTime()
+		if err != nil {
+			return nil, err
+		}
+		labels[ctlb.LabelCreated] = created
+	}
+
+	return labels, nil
+}
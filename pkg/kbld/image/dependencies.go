@@ -0,0 +1,130 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+var (
+	dockerfileArgRegexp  = regexp.MustCompile(`(?i)\AARG\s+([A-Za-z_][A-Za-z0-9_]*)(?:=(\S*))?`)
+	dockerfileFromRegexp = regexp.MustCompile(`(?i)\AFROM\s+(?:--platform=\S+\s+)?(\S+)(?:\s+AS\s+(\S+))?`)
+	dockerfileVarRegexp  = regexp.MustCompile(`\A\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))\z`)
+)
+
+// buildDependencies returns explicitly configured dependencies followed by
+// dependencies detected from Dockerfile FROM instructions that refer to other sources
+func (f Factory) buildDependencies(url string, src ctlconf.Source) ([]ctlconf.SourceDependency, error) {
+	result := append([]ctlconf.SourceDependency{}, src.DependsOn...)
+
+	detected, err := f.dockerfileDependencies(url, src)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dep := range detected {
+		var found bool
+		for _, existingDep := range result {
+			if existingDep.Image == dep.Image {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, dep)
+		}
+	}
+
+	return result, nil
+}
+
+func (f Factory) dockerfileDependencies(url string, src ctlconf.Source) ([]ctlconf.SourceDependency, error) {
+	path := src.DockerfilePath()
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	fromRefs, err := dockerfileFromRefs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ctlconf.SourceDependency
+
+	for _, fromRef := range fromRefs {
+		// Source is allowed to refer to its own image (e.g. previously built version)
+		if fromRef.Image == url {
+			continue
+		}
+		if _, found := f.shouldBuild(fromRef.Image); found {
+			result = append(result, fromRef)
+		}
+	}
+
+	return result, nil
+}
+
+// dockerfileFromRefs returns images referenced by FROM instructions.
+// FROM instructions that use global ARGs (e.g. FROM ${BASE}) are resolved
+// via ARG default values and returned with BuildArg set.
+func dockerfileFromRefs(path string) ([]ctlconf.SourceDependency, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Reading Dockerfile: %s", err)
+	}
+	defer file.Close()
+
+	globalArgs := map[string]string{}
+	stages := map[string]struct{}{}
+	seenFrom := false
+
+	var result []ctlconf.SourceDependency
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Only ARGs declared before first FROM can be used in FROM instructions
+		if matches := dockerfileArgRegexp.FindStringSubmatch(line); len(matches) > 0 && !seenFrom {
+			globalArgs[matches[1]] = strings.Trim(matches[2], `"'`)
+			continue
+		}
+
+		matches := dockerfileFromRegexp.FindStringSubmatch(line)
+		if len(matches) == 0 {
+			continue
+		}
+		seenFrom = true
+
+		dep := ctlconf.SourceDependency{Image: matches[1]}
+
+		if varMatches := dockerfileVarRegexp.FindStringSubmatch(dep.Image); len(varMatches) > 0 {
+			dep.BuildArg = varMatches[1] + varMatches[2]
+			dep.Image = globalArgs[dep.BuildArg]
+		}
+
+		if _, found := stages[strings.ToLower(dep.Image)]; len(dep.Image) > 0 && !found {
+			result = append(result, dep)
+		}
+
+		if len(matches[2]) > 0 {
+			stages[strings.ToLower(matches[2])] = struct{}{}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Reading Dockerfile: %s", err)
+	}
+
+	return result, nil
+}
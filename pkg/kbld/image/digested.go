@@ -4,6 +4,7 @@
 package image
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -41,7 +42,7 @@ func NewDigestedImageFromParts(url, digest string) DigestedImage {
 	return DigestedImage{nameWithDigest, nil}
 }
 
-func (i DigestedImage) URL() (string, []ctlconf.Origin, error) {
+func (i DigestedImage) URL(_ context.Context) (string, []ctlconf.Origin, error) {
 	if i.parseErr != nil {
 		return "", nil, i.parseErr
 	}
@@ -4,6 +4,7 @@
 package image
 
 import (
+	"context"
 	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 )
 
@@ -15,4 +16,4 @@ var _ Image = ErrImage{}
 
 func NewErrImage(err error) ErrImage { return ErrImage{err} }
 
-func (i ErrImage) URL() (string, []ctlconf.Origin, error) { return "", nil, i.err }
+func (i ErrImage) URL(_ context.Context) (string, []ctlconf.Origin, error) { return "", nil, i.err }
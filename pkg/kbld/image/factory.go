@@ -4,38 +4,57 @@
 package image
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
-	ctlbbz "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/bazel"
-	ctlbdk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/docker"
-	ctlbko "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/ko"
-	ctlbkb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/kubectlbuildkit"
-	ctlbpk "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/pack"
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbc "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/cache"
 	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
 	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
 )
 
 type Image interface {
-	URL() (string, []ctlconf.Origin, error)
+	URL(context.Context) (string, []ctlconf.Origin, error)
 }
 
 type Factory struct {
 	opts     FactoryOpts
 	registry ctlreg.Registry
 	logger   ctllog.Logger
+	built    *sharedImages
 }
 
 type FactoryOpts struct {
 	Conf           ctlconf.Conf
 	AllowedToBuild bool
+	// ProvenanceLabels adds OCI labels (revision, source, etc.) to built images
+	// (pack requires paketo image-labels buildpack; ko, bazel and exec are not supported)
+	ProvenanceLabels bool
+	// BuildCache (if set) is used to skip builds of unchanged sources
+	BuildCache *ctlbc.Cache
+	// BuildLogDir (if set) receives build output of each image in its own file
+	BuildLogDir string
+	// Builders default to NewDefaultBuilders
+	Builders *ctlb.Builders
 }
 
 func NewFactory(opts FactoryOpts, registry ctlreg.Registry, logger ctllog.Logger) Factory {
-	return Factory{opts, registry, logger}
+	f := Factory{opts, registry, logger, newSharedImages()}
+	if f.opts.Builders == nil {
+		f.opts.Builders = NewDefaultBuilders(registry, f.buildLogger())
+	}
+	return f
 }
 
 func (f Factory) New(url string) Image {
+	return f.new(url, nil)
+}
+
+// new keeps track of dependents (sources that depend on this image)
+// to detect build dependency cycles
+func (f Factory) new(url string, dependents []string) Image {
 	if overrideConf, found := f.shouldOverride(url); found {
 		url = overrideConf.NewImage
 		if overrideConf.Preresolved {
@@ -50,22 +69,41 @@ func (f Factory) New(url string) Image {
 			return NewErrImage(fmt.Errorf("Building of images is disallowed (tried to build '%s' because a source was configured for it)", url))
 		}
 
-		imgDstConf := f.optionalPushConf(url)
+		for _, dependent := range dependents {
+			if dependent == url {
+				return NewErrImage(fmt.Errorf("Detected build dependency cycle: %s",
+					strings.Join(append(dependents, url), " -> ")))
+			}
+		}
 
-		docker := ctlbdk.NewDocker(f.logger)
-		pack := ctlbpk.NewPack(docker, f.logger)
-		kubectlBuildkit := ctlbkb.NewKubectlBuildkit(f.logger)
-		ko := ctlbko.NewKo(f.logger)
-		bazel := ctlbbz.NewBazel(docker, f.logger)
+		deps, err := f.newDependencies(url, srcConf, dependents)
+		if err != nil {
+			return NewErrImage(err)
+		}
 
-		builtImg := NewBuiltImage(url, srcConf, imgDstConf,
-			docker, pack, kubectlBuildkit, ko, bazel)
+		builder, err := f.opts.Builders.Find(srcConf.Type())
+		if err != nil {
+			return NewErrImage(err)
+		}
+
+		if f.opts.BuildCache != nil {
+			builder = ctlbc.NewCachedBuilder(builder, *f.opts.BuildCache, f.registry, f.buildLogger())
+		}
+
+		imgDstConf := f.optionalPushConf(url)
+
+		var img Image = NewBuiltImage(url, srcConf, imgDstConf, deps, builder, f.opts.ProvenanceLabels)
 
 		if imgDstConf != nil {
-			return NewTaggedImage(builtImg, *imgDstConf, f.registry)
+			img = NewTaggedImage(img, *imgDstConf, f.registry)
+		}
+
+		if len(f.opts.BuildLogDir) > 0 {
+			// Builders and pushers log using image URL as prefix
+			img = NewLoggedImage(img, url, f.buildLogger().LogPath(url+" | "), f.logger)
 		}
 
-		return builtImg
+		return f.built.Image(url, img)
 	}
 
 	digestedImage := MaybeNewDigestedImage(url)
@@ -76,6 +114,34 @@ func (f Factory) New(url string) Image {
 	return NewResolvedImage(url, f.registry)
 }
 
+func (f Factory) buildLogger() ctllog.Logger {
+	if len(f.opts.BuildLogDir) > 0 {
+		return f.logger.WithLogDir(f.opts.BuildLogDir)
+	}
+	return f.logger
+}
+
+func (f Factory) newDependencies(url string, srcConf ctlconf.Source, dependents []string) ([]BuiltImageDependency, error) {
+	depConfs, err := f.buildDependencies(url, srcConf)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents = append(append([]string{}, dependents...), url)
+
+	var deps []BuiltImageDependency
+
+	for _, depConf := range depConfs {
+		depImg := f.new(depConf.Image, dependents)
+		if errImg, ok := depImg.(ErrImage); ok {
+			return nil, errImg.err
+		}
+		deps = append(deps, BuiltImageDependency{depConf.Image, depConf.BuildArg, depImg})
+	}
+
+	return deps, nil
+}
+
 func (f Factory) shouldOverride(url string) (ctlconf.ImageOverride, bool) {
 	urlMatcher := Matcher{url}
 	for _, override := range f.opts.Conf.ImageOverrides() {
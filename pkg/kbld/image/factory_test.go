@@ -0,0 +1,371 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctlimg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/image"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+type fakeBuilder struct {
+	builtSources []ctlconf.Source
+	labels       map[string]string
+	builtImages  []string
+	buildArgs    map[string]map[string]string
+}
+
+func (b *fakeBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	b.builtSources = append(b.builtSources, src)
+	b.labels = ctlb.LabelsFromContext(ctx)
+	b.builtImages = append(b.builtImages, image)
+
+	if b.buildArgs == nil {
+		b.buildArgs = map[string]map[string]string{}
+	}
+	b.buildArgs[image] = ctlb.BuildArgsFromContext(ctx)
+
+	url := "kbld:" + image
+	if imgDst != nil {
+		url = imgDst.NewImage + "@sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d"
+	}
+	return ctlb.BuildResult{URL: url}, nil
+}
+
+func TestFactoryUsesRegisteredBuilder(t *testing.T) {
+	srcPath := t.TempDir()
+
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     srcPath,
+			Custom: &ctlconf.SourceCustomOpts{
+				Builder: "in-house",
+				Opts:    map[string]interface{}{"target": "prod"},
+			},
+		}},
+		Destinations: []ctlconf.ImageDestination{{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			NewImage: "registry.io/app",
+		}},
+	})
+
+	builder := &fakeBuilder{}
+	builders := ctlb.NewBuilders()
+	builders.Add("in-house", builder)
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: builders}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, ctllog.NewLogger(&bytes.Buffer{}))
+
+	url, origins, err := factory.New("app").URL(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedURL := "registry.io/app@sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d"
+	if url != expectedURL {
+		t.Fatalf("Expected url >>>%s<<< to match >>>%s<<<", url, expectedURL)
+	}
+
+	if len(origins) != 1 || origins[0].Local == nil || origins[0].Local.Path != srcPath {
+		t.Fatalf("Expected origins to include local path, but was %#v", origins)
+	}
+
+	if len(builder.builtSources) != 1 || builder.builtSources[0].Custom.Opts["target"] != "prod" {
+		t.Fatalf("Expected builder to receive source opts, but was %#v", builder.builtSources)
+	}
+}
+
+func TestFactoryErrsForUnknownBuilder(t *testing.T) {
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     t.TempDir(),
+			Custom:   &ctlconf.SourceCustomOpts{Builder: "unknown"},
+		}},
+	})
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: ctlb.NewBuilders()}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, ctllog.NewLogger(&bytes.Buffer{}))
+
+	_, _, err := factory.New("app").URL(context.Background())
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected to find builder for source type 'unknown' (known types: [])"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+}
+
+func TestFactoryAddsProvenanceLabels(t *testing.T) {
+	srcPath := t.TempDir()
+
+	runCmd(t, "git", []string{"init", "."}, srcPath)
+	runCmd(t, "git", []string{"remote", "add", "origin", "https://github.com/org/app"}, srcPath)
+	runCmd(t, "git", []string{"commit", "-am", "msg1", "--allow-empty"}, srcPath)
+	runCmd(t, "git", []string{"tag", "v1.2.0"}, srcPath)
+
+	sha := strings.TrimSpace(runCmd(t, "git", []string{"rev-parse", "HEAD"}, srcPath))
+
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     srcPath,
+			Custom:   &ctlconf.SourceCustomOpts{Builder: "in-house"},
+		}},
+	})
+
+	builder := &fakeBuilder{}
+	builders := ctlb.NewBuilders()
+	builders.Add("in-house", builder)
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, ProvenanceLabels: true, Builders: builders}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, ctllog.NewLogger(&bytes.Buffer{}))
+
+	_, _, err := factory.New("app").URL(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedLabels := map[string]string{
+		ctlb.LabelRevision: sha,
+		ctlb.LabelSource:   "https://github.com/org/app",
+		ctlb.LabelVersion:  "v1.2.0",
+	}
+
+	for k, v := range expectedLabels {
+		if builder.labels[k] != v {
+			t.Fatalf("Expected label %s to be >>>%s<<<, but was >>>%s<<<", k, v, builder.labels[k])
+		}
+	}
+
+	if len(builder.labels[ctlb.LabelCreated]) == 0 {
+		t.Fatalf("Expected created label to be set, but was %#v", builder.labels)
+	}
+}
+
+func TestFactoryBuildsDependenciesFirst(t *testing.T) {
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef:  ctlconf.ImageRef{Image: "app"},
+			Path:      t.TempDir(),
+			Custom:    &ctlconf.SourceCustomOpts{Builder: "in-house"},
+			DependsOn: []ctlconf.SourceDependency{{Image: "base", BuildArg: "BASE_IMAGE"}, {Image: "tools"}},
+		}, {
+			ImageRef: ctlconf.ImageRef{Image: "base"},
+			Path:     t.TempDir(),
+			Custom:   &ctlconf.SourceCustomOpts{Builder: "in-house"},
+		}, {
+			ImageRef:  ctlconf.ImageRef{Image: "tools"},
+			Path:      t.TempDir(),
+			Custom:    &ctlconf.SourceCustomOpts{Builder: "in-house"},
+			DependsOn: []ctlconf.SourceDependency{{Image: "base"}},
+		}},
+		Destinations: []ctlconf.ImageDestination{{
+			ImageRef: ctlconf.ImageRef{Image: "base"},
+			NewImage: "registry.io/base",
+		}},
+	})
+
+	builder := &fakeBuilder{}
+	builders := ctlb.NewBuilders()
+	builders.Add("in-house", builder)
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: builders}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, ctllog.NewLogger(&bytes.Buffer{}))
+
+	_, _, err := factory.New("app").URL(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	// base is only built once even though both app and tools depend on it
+	expectedImages := []string{"base", "tools", "app"}
+	if !reflect.DeepEqual(builder.builtImages, expectedImages) {
+		t.Fatalf("Expected built images %#v to match %#v", builder.builtImages, expectedImages)
+	}
+
+	expectedBuildArgs := map[string]string{
+		"BASE_IMAGE": "registry.io/base@sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d",
+	}
+	if !reflect.DeepEqual(builder.buildArgs["app"], expectedBuildArgs) {
+		t.Fatalf("Expected build args %#v to match %#v", builder.buildArgs["app"], expectedBuildArgs)
+	}
+}
+
+func TestFactoryDetectsDockerfileDependencies(t *testing.T) {
+	appPath := t.TempDir()
+
+	dockerfile := `ARG BASE_IMAGE=base
+FROM golang:1.17 AS build
+FROM ${BASE_IMAGE}
+COPY --from=build /app /app
+`
+	err := ioutil.WriteFile(filepath.Join(appPath, "Dockerfile"), []byte(dockerfile), 0600)
+	if err != nil {
+		t.Fatalf("Writing Dockerfile: %s", err)
+	}
+
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef: ctlconf.ImageRef{Image: "app"},
+			Path:     appPath,
+		}, {
+			ImageRef: ctlconf.ImageRef{Image: "base"},
+			Path:     t.TempDir(),
+		}},
+	})
+
+	builder := &fakeBuilder{}
+	builders := ctlb.NewBuilders()
+	builders.Add(ctlconf.SourceTypeDocker, builder)
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: builders}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, ctllog.NewLogger(&bytes.Buffer{}))
+
+	_, _, err = factory.New("app").URL(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	expectedImages := []string{"base", "app"}
+	if !reflect.DeepEqual(builder.builtImages, expectedImages) {
+		t.Fatalf("Expected built images %#v to match %#v", builder.builtImages, expectedImages)
+	}
+
+	expectedBuildArgs := map[string]string{"BASE_IMAGE": "kbld:base"}
+	if !reflect.DeepEqual(builder.buildArgs["app"], expectedBuildArgs) {
+		t.Fatalf("Expected build args %#v to match %#v", builder.buildArgs["app"], expectedBuildArgs)
+	}
+}
+
+func TestFactoryErrsForDependencyCycle(t *testing.T) {
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef:  ctlconf.ImageRef{Image: "app"},
+			Path:      t.TempDir(),
+			Custom:    &ctlconf.SourceCustomOpts{Builder: "in-house"},
+			DependsOn: []ctlconf.SourceDependency{{Image: "base"}},
+		}, {
+			ImageRef:  ctlconf.ImageRef{Image: "base"},
+			Path:      t.TempDir(),
+			Custom:    &ctlconf.SourceCustomOpts{Builder: "in-house"},
+			DependsOn: []ctlconf.SourceDependency{{Image: "app"}},
+		}},
+	})
+
+	builder := &fakeBuilder{}
+	builders := ctlb.NewBuilders()
+	builders.Add("in-house", builder)
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: builders}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, ctllog.NewLogger(&bytes.Buffer{}))
+
+	_, _, err := factory.New("app").URL(context.Background())
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Detected build dependency cycle: app -> base -> app"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+
+	if len(builder.builtImages) != 0 {
+		t.Fatalf("Expected no images to be built, but was %#v", builder.builtImages)
+	}
+}
+
+type failingBuilder struct {
+	logger ctllog.Logger
+}
+
+func (b failingBuilder) Build(ctx context.Context, image string,
+	src ctlconf.Source, imgDst *ctlconf.ImageDestination) (ctlb.BuildResult, error) {
+
+	prefixedLogger := b.logger.NewPrefixedWriter(image + " | ")
+	for i := 0; i < 30; i++ {
+		prefixedLogger.WriteStr("step %d\n", i)
+	}
+	return ctlb.BuildResult{}, fmt.Errorf("build failed")
+}
+
+func TestFactoryWritesBuildLogs(t *testing.T) {
+	logDir := t.TempDir()
+
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{{
+			ImageRef: ctlconf.ImageRef{ImageRepo: "app"},
+			Path:     t.TempDir(),
+			Custom:   &ctlconf.SourceCustomOpts{Builder: "in-house"},
+		}},
+	})
+
+	var buf bytes.Buffer
+	logger := ctllog.NewLogger(&buf)
+
+	builders := ctlb.NewBuilders()
+	builders.Add("in-house", failingBuilder{logger.WithLogDir(logDir)})
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, BuildLogDir: logDir, Builders: builders}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, logger)
+
+	_, _, err := factory.New("app").URL(context.Background())
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	logPath := logger.WithLogDir(logDir).LogPath("app | ")
+
+	bs, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Reading build log: %s", err)
+	}
+	if !strings.HasPrefix(string(bs), "step 0\n") || !strings.HasSuffix(string(bs), "step 29\n") {
+		t.Fatalf("Expected build log to include full output, but was >>>%s<<<", bs)
+	}
+
+	expectedOut := "app | starting build (log: " + logPath + ")\n" +
+		"app | failed build: build failed\n" +
+		"app | last lines of " + logPath + ":\n" +
+		"app | step 10\n"
+	if !strings.HasPrefix(buf.String(), expectedOut) || !strings.HasSuffix(buf.String(), "app | step 29\n") {
+		t.Fatalf("Expected output >>>%s<<< to start with >>>%s<<<", buf.String(), expectedOut)
+	}
+	if strings.Contains(buf.String(), "step 9\n") {
+		t.Fatalf("Expected output to only include tail of build log, but was >>>%s<<<", buf.String())
+	}
+
+	// Image of the same repository uses its own log
+	_, _, err = factory.New("app:v2").URL(context.Background())
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	otherLogPath := logger.WithLogDir(logDir).LogPath("app:v2 | ")
+	if otherLogPath == logPath {
+		t.Fatalf("Expected log paths of different images to differ")
+	}
+	for _, path := range []string{logPath, otherLogPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("Expected build log '%s' to exist, but was: %s", path, err)
+		}
+	}
+}
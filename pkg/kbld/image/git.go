@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+
+	ctlbin "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/inputs"
 )
 
 const (
@@ -63,6 +65,16 @@ func (r GitRepo) HeadTags() ([]string, error) {
 	return strings.Split(strings.TrimSpace(stdout), "\n"), nil
 }
 
+// HeadCommitTime returns committer date of HEAD commit in RFC 3339 format
+func (r GitRepo) HeadCommitTime() (string, error) {
+	stdout, stderr, err := r.runCmd([]string{"log", "-1", "--format=%cI", "HEAD"})
+	if err != nil {
+		return "", r.error("Checking HEAD commit time: %s (stderr '%s')", err, stderr)
+	}
+
+	return strings.TrimSpace(stdout), nil
+}
+
 func (r GitRepo) IsDirty() (bool, error) {
 	stdout, _, err := r.runCmd([]string{"status", "--short"})
 	if err != nil {
@@ -73,6 +85,32 @@ func (r GitRepo) IsDirty() (bool, error) {
 	return len(strings.TrimSpace(stdout)) > 0, nil
 }
 
+// IsDirtyInputs checks whether any of build inputs
+// (within source directory that repo was created for) have changed
+func (r GitRepo) IsDirtyInputs(srcInputs ctlbin.Inputs) (bool, error) {
+	args := []string{"-c", "status.relativePaths=true", "status", "--short", "--untracked-files=all", "--"}
+	args = append(args, srcInputs.WatchPaths()...)
+
+	stdout, _, err := r.runCmd(args)
+	if err != nil {
+		return false, r.error("Checking status: %s", err)
+	}
+
+	for _, line := range strings.Split(stdout, "\n") {
+		// Format: 'XY path' or 'XY orig-path -> path'
+		if len(line) < 4 {
+			continue
+		}
+		for _, path := range strings.Split(line[3:], " -> ") {
+			if srcInputs.Matches(strings.Trim(path, `"`)) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
 func (r GitRepo) IsValid() bool {
 	// Prints .git directory path if it's git repo
 	_, _, err := r.runCmd([]string{"rev-parse", "--git-dir"})
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"testing"
 
+	ctlbin "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/inputs"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 	ctlimg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/image"
 )
 
@@ -269,6 +271,68 @@ func TestGitRepoIsDirty(t *testing.T) {
 	}
 }
 
+func TestGitRepoIsDirtyInputs(t *testing.T) {
+	dir := t.TempDir()
+
+	runCmd(t, "git", []string{"init", "."}, dir)
+
+	for _, path := range []string{"app/main.go", "app/README.md", "other/main.go"} {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), os.ModePerm)
+		if err != nil {
+			t.Fatalf("Making dir: %s", err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, path), []byte("v1"), 0600)
+		if err != nil {
+			t.Fatalf("Writing file: %s", err)
+		}
+	}
+
+	runCmd(t, "git", []string{"add", "."}, dir)
+	runCmd(t, "git", []string{"commit", "-m", "msg1"}, dir)
+
+	srcInputs, err := ctlbin.NewInputs(ctlconf.Source{
+		Path:       dir,
+		WatchPaths: []string{"app"},
+		Exclude:    []string{"**/*.md"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	gitRepo := ctlimg.NewGitRepo(dir)
+
+	assertDirty := func(expected bool) {
+		dirty, err := gitRepo.IsDirtyInputs(srcInputs)
+		if err != nil {
+			t.Fatalf("Expected dirty to succeed: %s", err)
+		}
+		if dirty != expected {
+			t.Fatalf("Expected dirty to be %t, but was %t", expected, dirty)
+		}
+	}
+
+	assertDirty(false)
+
+	// Changes outside of inputs do not make source dirty
+	err = ioutil.WriteFile(filepath.Join(dir, "other/main.go"), []byte("v2"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "app/README.md"), []byte("v2"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	assertDirty(false)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "app/new.go"), []byte("v1"), 0600)
+	if err != nil {
+		t.Fatalf("Writing file: %s", err)
+	}
+
+	assertDirty(true)
+}
+
 func runCmd(t *testing.T, cmdName string, args []string, dir string) string {
 	var stdoutBuf, stderrBuf bytes.Buffer
 
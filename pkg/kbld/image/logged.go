@@ -0,0 +1,74 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+)
+
+const (
+	loggedImageTailLines = 20
+)
+
+// LoggedImage reports summary of a build whose full output
+// is captured in log file (and tail of that log on failure)
+type LoggedImage struct {
+	image   Image
+	url     string
+	logPath string
+	logger  ctllog.Logger
+}
+
+var _ Image = LoggedImage{}
+
+func NewLoggedImage(image Image, url string, logPath string, logger ctllog.Logger) LoggedImage {
+	return LoggedImage{image, url, logPath, logger}
+}
+
+func (i LoggedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	prefixedLogger := i.logger.NewPrefixedWriter(i.url + " | ")
+
+	// Start with fresh log so that it only includes latest build
+	os.Remove(i.logPath)
+
+	prefixedLogger.WriteStr("starting build (log: %s)\n", i.logPath)
+
+	url, origins, err := i.image.URL(ctx)
+	if err != nil {
+		prefixedLogger.WriteStr("failed build: %s\n", err)
+
+		tail := i.tail(i.logPath)
+		if len(tail) > 0 {
+			prefixedLogger.WriteStr("last lines of %s:\n%s", i.logPath, tail)
+		}
+		return "", nil, err
+	}
+
+	prefixedLogger.WriteStr("finished build: %s\n", url)
+
+	return url, origins, nil
+}
+
+func (i LoggedImage) tail(path string) string {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	lines := strings.SplitAfter(string(bs), "\n")
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > loggedImageTailLines {
+		lines = lines[len(lines)-loggedImageTailLines:]
+	}
+
+	return strings.Join(lines, "")
+}
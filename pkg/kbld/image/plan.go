@@ -0,0 +1,182 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+const (
+	PlanDecisionOverride    = "override"
+	PlanDecisionPreresolved = "preresolved"
+	PlanDecisionTagSelected = "tag-selected"
+	PlanDecisionBuild       = "build"
+	PlanDecisionPush        = "push"
+	PlanDecisionDigest      = "digest"
+	PlanDecisionResolve     = "resolve"
+	PlanDecisionError       = "error"
+)
+
+// ImagePlan describes how image would be resolved by Factory
+// without building, pushing or tagging anything
+type ImagePlan struct {
+	URL          string
+	Steps        []ImagePlanStep
+	Dependencies []ImagePlanDependency
+}
+
+type ImagePlanStep struct {
+	Decision    string
+	Description string
+	// Rule describes matching config rule (if any)
+	Rule string
+}
+
+type ImagePlanDependency struct {
+	BuildArg string
+	Plan     ImagePlan
+}
+
+// Plan mirrors New but only records decisions
+func (f Factory) Plan(url string) ImagePlan {
+	return f.plan(url, nil)
+}
+
+func (f Factory) plan(url string, dependents []string) ImagePlan {
+	plan := ImagePlan{URL: url}
+
+	if overrideConf, found := f.shouldOverride(url); found {
+		rule := planRule("override", overrideConf.ImageRef)
+		plan.addStep(PlanDecisionOverride, fmt.Sprintf("replace with %s", overrideConf.NewImage), rule)
+
+		url = overrideConf.NewImage
+		if overrideConf.Preresolved {
+			plan.addStep(PlanDecisionPreresolved, fmt.Sprintf("use %s as is", url), "")
+			return plan
+		} else if overrideConf.TagSelection != nil {
+			plan.addStep(PlanDecisionTagSelected, fmt.Sprintf("select tag of %s from registry", url), "")
+			return plan
+		}
+	}
+
+	if srcConf, found := f.shouldBuild(url); found {
+		rule := planRule("source", srcConf.ImageRef)
+
+		if !f.opts.AllowedToBuild {
+			plan.addStep(PlanDecisionError, "building of images is disallowed", rule)
+			return plan
+		}
+
+		for _, dependent := range dependents {
+			if dependent == url {
+				plan.addStep(PlanDecisionError, fmt.Sprintf("detected build dependency cycle: %s",
+					strings.Join(append(dependents, url), " -> ")), rule)
+				return plan
+			}
+		}
+
+		_, err := f.opts.Builders.Find(srcConf.Type())
+		if err != nil {
+			plan.addStep(PlanDecisionError, err.Error(), rule)
+			return plan
+		}
+
+		depConfs, err := f.buildDependencies(url, srcConf)
+		if err != nil {
+			plan.addStep(PlanDecisionError, err.Error(), rule)
+			return plan
+		}
+
+		depDependents := append(append([]string{}, dependents...), url)
+
+		for _, depConf := range depConfs {
+			plan.Dependencies = append(plan.Dependencies, ImagePlanDependency{
+				BuildArg: depConf.BuildArg,
+				Plan:     f.plan(depConf.Image, depDependents),
+			})
+		}
+
+		imgDstConf := f.optionalPushConf(url)
+
+		err = checkNoDigestTag(srcConf, imgDstConf)
+		if err != nil {
+			plan.addStep(PlanDecisionError, err.Error(), planRule("destination", imgDstConf.ImageRef))
+			return plan
+		}
+
+		buildDesc := fmt.Sprintf("build %s with %s builder", srcConf.ContextPath(), srcConf.Type())
+		// Build cache only applies to pushed images (see CachedBuilder)
+		if f.opts.BuildCache != nil && imgDstConf != nil {
+			buildDesc += " (skipped if unchanged since last build)"
+		}
+		plan.addStep(PlanDecisionBuild, buildDesc, rule)
+
+		if imgDstConf != nil {
+			plan.addStep(PlanDecisionPush, planPushDescription(*imgDstConf), planRule("destination", imgDstConf.ImageRef))
+		}
+
+		return plan
+	}
+
+	if MaybeNewDigestedImage(url) != nil {
+		plan.addStep(PlanDecisionDigest, fmt.Sprintf("use %s as is (includes digest)", url), "")
+		return plan
+	}
+
+	plan.addStep(PlanDecisionResolve, fmt.Sprintf("resolve %s to digest from registry", url), "")
+	return plan
+}
+
+func (p *ImagePlan) addStep(decision, desc, rule string) {
+	p.Steps = append(p.Steps, ImagePlanStep{Decision: decision, Description: desc, Rule: rule})
+}
+
+// Description returns human readable plan including plans of dependencies
+func (p ImagePlan) Description() string {
+	return strings.Join(p.descriptionLines(""), "\n") + "\n"
+}
+
+func (p ImagePlan) descriptionLines(indent string) []string {
+	lines := []string{indent + p.URL}
+
+	for _, dep := range p.Dependencies {
+		depDesc := "depends on"
+		if len(dep.BuildArg) > 0 {
+			depDesc += fmt.Sprintf(" (build arg %s)", dep.BuildArg)
+		}
+		lines = append(lines, indent+"  "+depDesc+":")
+		lines = append(lines, dep.Plan.descriptionLines(indent+"    ")...)
+	}
+
+	for _, step := range p.Steps {
+		lines = append(lines, fmt.Sprintf("%s  %s: %s", indent, step.Decision, step.Description))
+		if len(step.Rule) > 0 {
+			lines = append(lines, fmt.Sprintf("%s    rule: %s", indent, step.Rule))
+		}
+	}
+
+	return lines
+}
+
+func planPushDescription(imgDst ctlconf.ImageDestination) string {
+	desc := "push to " + imgDst.NewImage
+	if imgDst.DigestTag {
+		desc += " as kbld-sha256-<digest>"
+	}
+	if len(imgDst.Tags) > 0 {
+		desc += " and tag with " + strings.Join(imgDst.Tags, ", ")
+	}
+	return desc
+}
+
+func planRule(kind string, imageRef ctlconf.ImageRef) string {
+	rule := fmt.Sprintf("%s for %s", kind, imageRef.Description())
+	if len(imageRef.DefinedIn()) > 0 {
+		rule += " in " + imageRef.DefinedIn()
+	}
+	return rule
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	ctlb "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder"
+	ctlbc "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/builder/cache"
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+	ctlimg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/image"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+	ctlres "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/resources"
+)
+
+func TestFactoryPlanDoesNotBuild(t *testing.T) {
+	srcPath := t.TempDir()
+
+	configPath := filepath.Join(t.TempDir(), "kbld.yml")
+	config := `
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+sources:
+- image: app
+  path: ` + srcPath + `
+  custom:
+    builder: in-house
+  dependsOn:
+  - image: base
+    buildArg: BASE_IMAGE
+- image: base
+  path: ` + srcPath + `
+  custom:
+    builder: in-house
+destinations:
+- image: app
+  newImage: registry.io/app
+  tags: [latest]
+overrides:
+- image: redis
+  newImage: redis@sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d
+  preresolved: true
+`
+	err := ioutil.WriteFile(configPath, []byte(config), 0600)
+	if err != nil {
+		t.Fatalf("Writing config: %s", err)
+	}
+
+	fileRs, err := ctlres.NewFileResources(configPath)
+	if err != nil {
+		t.Fatalf("Reading config: %s", err)
+	}
+
+	rs, err := fileRs[0].Resources()
+	if err != nil {
+		t.Fatalf("Parsing config: %s", err)
+	}
+
+	_, conf, err := ctlconf.NewConfFromResources(rs)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	builder := &fakeBuilder{}
+	builders := ctlb.NewBuilders()
+	builders.Add("in-house", builder)
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: builders}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, ctllog.NewLogger(&bytes.Buffer{}))
+
+	inFile := "in file '" + configPath + "'"
+
+	expectedPlans := map[string]string{
+		"app": `app
+  depends on (build arg BASE_IMAGE):
+    base
+      build: build ` + srcPath + ` with in-house builder
+        rule: source for image 'base' ` + inFile + `
+  build: build ` + srcPath + ` with in-house builder
+    rule: source for image 'app' ` + inFile + `
+  push: push to registry.io/app and tag with latest
+    rule: destination for image 'app' ` + inFile + `
+`,
+		"redis": `redis
+  override: replace with redis@sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d
+    rule: override for image 'redis' ` + inFile + `
+  preresolved: use redis@sha256:f7988fb6c02e0ce69257d9bd9cf37ae20a60f1df7563c3a2a6abe24160306b8d as is
+`,
+		"nginx": `nginx
+  resolve: resolve nginx to digest from registry
+`,
+	}
+
+	for url, expectedPlan := range expectedPlans {
+		plan := factory.Plan(url).Description()
+		if plan != expectedPlan {
+			t.Fatalf("Expected plan >>>%s<<< to match >>>%s<<<", plan, expectedPlan)
+		}
+	}
+
+	if len(builder.builtImages) != 0 {
+		t.Fatalf("Expected no images to be built, but was %#v", builder.builtImages)
+	}
+}
+
+func TestFactoryPlanAppliesBuildConditions(t *testing.T) {
+	srcPath := t.TempDir()
+
+	conf := ctlconf.Conf{}.WithAdditionalConfig(ctlconf.Config{
+		Sources: []ctlconf.Source{
+			{ImageRef: ctlconf.ImageRef{Image: "app"}, Path: srcPath, Custom: &ctlconf.SourceCustomOpts{Builder: "in-house"}},
+			{ImageRef: ctlconf.ImageRef{Image: "local"}, Path: srcPath, Custom: &ctlconf.SourceCustomOpts{Builder: "in-house"}},
+			{ImageRef: ctlconf.ImageRef{Image: "worker"}, Path: srcPath, KubectlBuildkit: &ctlconf.SourceKubectlBuildkitOpts{}},
+		},
+		Destinations: []ctlconf.ImageDestination{
+			{ImageRef: ctlconf.ImageRef{Image: "app"}, NewImage: "registry.io/app"},
+			{ImageRef: ctlconf.ImageRef{Image: "worker"}, NewImage: "registry.io/worker", DigestTag: true},
+		},
+	})
+
+	builders := ctlb.NewBuilders()
+	builders.Add("in-house", &fakeBuilder{})
+	builders.Add(ctlconf.SourceTypeKubectlBuildkit, &fakeBuilder{})
+
+	buildCache := ctlbc.NewCache(t.TempDir())
+
+	opts := ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true, Builders: builders, BuildCache: &buildCache}
+	factory := ctlimg.NewFactory(opts, ctlreg.Registry{}, ctllog.NewLogger(&bytes.Buffer{}))
+
+	expectedPlans := map[string]string{
+		// Build cache only applies to images that are pushed
+		"app": `app
+  build: build ` + srcPath + ` with in-house builder (skipped if unchanged since last build)
+    rule: source for image 'app'
+  push: push to registry.io/app
+    rule: destination for image 'app'
+`,
+		"local": `local
+  build: build ` + srcPath + ` with in-house builder
+    rule: source for image 'local'
+`,
+		"worker": `worker
+  error: Expected destination 'registry.io/worker' to not use digestTag since kubectl-buildkit pushes images with random tags itself
+    rule: destination for image 'worker'
+`,
+	}
+
+	for url, expectedPlan := range expectedPlans {
+		plan := factory.Plan(url).Description()
+		if plan != expectedPlan {
+			t.Fatalf("Expected plan >>>%s<<< to match >>>%s<<<", plan, expectedPlan)
+		}
+	}
+}
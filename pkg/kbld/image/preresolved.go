@@ -4,6 +4,7 @@
 package image
 
 import (
+	"context"
 	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 )
 
@@ -16,7 +17,7 @@ func NewPreresolvedImage(url string, origins []ctlconf.Origin) PreresolvedImage
 	return PreresolvedImage{url, copyAndAppendOrigins(origins)}
 }
 
-func (i PreresolvedImage) URL() (string, []ctlconf.Origin, error) {
+func (i PreresolvedImage) URL(_ context.Context) (string, []ctlconf.Origin, error) {
 	imageOrigins := copyAndAppendOrigins(i.origins, ctlconf.Origin{Preresolved: &ctlconf.OriginPreresolved{URL: i.url}})
 	return i.url, imageOrigins, nil
 }
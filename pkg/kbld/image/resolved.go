@@ -4,6 +4,7 @@
 package image
 
 import (
+	"context"
 	"fmt"
 
 	regname "github.com/google/go-containerregistry/pkg/name"
@@ -21,13 +22,13 @@ func NewResolvedImage(url string, registry ctlreg.Registry) ResolvedImage {
 	return ResolvedImage{url, registry}
 }
 
-func (i ResolvedImage) URL() (string, []ctlconf.Origin, error) {
+func (i ResolvedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
 	tag, err := regname.NewTag(i.url, regname.WeakValidation)
 	if err != nil {
 		return "", nil, err
 	}
 
-	imgDescriptor, err := i.registry.Generic(tag)
+	imgDescriptor, err := i.registry.Generic(ctx, tag)
 	if err != nil {
 		return "", nil, err
 	}
@@ -35,7 +36,7 @@ func (i ResolvedImage) URL() (string, []ctlconf.Origin, error) {
 	// Resolve image second time because some older registry can
 	// return "random" digests that change for every request.
 	// See https://github.com/vmware-tanzu/carvel-kbld/issues/21 for details.
-	imgDescriptor2, err := i.registry.Generic(tag)
+	imgDescriptor2, err := i.registry.Generic(ctx, tag)
 	if err != nil {
 		return "", nil, err
 	}
@@ -44,7 +45,7 @@ func (i ResolvedImage) URL() (string, []ctlconf.Origin, error) {
 		return "", nil, fmt.Errorf("Expected digest resolution to be consistent over two separate requests")
 	}
 
-	url, origins, err := NewDigestedImageFromParts(tag.Repository.String(), imgDescriptor.Digest.String()).URL()
+	url, origins, err := NewDigestedImageFromParts(tag.Repository.String(), imgDescriptor.Digest.String()).URL(ctx)
 	if err != nil {
 		return "", nil, err
 	}
@@ -0,0 +1,56 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"sync"
+
+	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
+)
+
+// sharedImages makes sure that each built image is only built once
+// even if it's referenced by resources as well as by dependent sources
+type sharedImages struct {
+	results     map[string]*sharedResult
+	resultsLock sync.Mutex
+}
+
+type sharedResult struct {
+	once    sync.Once
+	url     string
+	origins []ctlconf.Origin
+	err     error
+}
+
+func newSharedImages() *sharedImages {
+	return &sharedImages{results: map[string]*sharedResult{}}
+}
+
+func (s *sharedImages) Image(url string, img Image) Image {
+	s.resultsLock.Lock()
+	defer s.resultsLock.Unlock()
+
+	result, found := s.results[url]
+	if !found {
+		result = &sharedResult{}
+		s.results[url] = result
+	}
+
+	return SharedImage{img, result}
+}
+
+type SharedImage struct {
+	image  Image
+	result *sharedResult
+}
+
+var _ Image = SharedImage{}
+
+func (i SharedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	i.result.once.Do(func() {
+		i.result.url, i.result.origins, i.result.err = i.image.URL(ctx)
+	})
+	return i.result.url, i.result.origins, i.result.err
+}
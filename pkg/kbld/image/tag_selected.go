@@ -4,6 +4,7 @@
 package image
 
 import (
+	"context"
 	"fmt"
 
 	regname "github.com/google/go-containerregistry/pkg/name"
@@ -26,7 +27,7 @@ func NewTagSelectedImage(url string, selection *v1alpha1.VersionSelection,
 	return TagSelectedImage{url, selection, registry}
 }
 
-func (i TagSelectedImage) URL() (string, []ctlconf.Origin, error) {
+func (i TagSelectedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
 	repo, err := regname.NewRepository(i.url, regname.WeakValidation)
 	if err != nil {
 		return "", nil, err
@@ -36,7 +37,7 @@ func (i TagSelectedImage) URL() (string, []ctlconf.Origin, error) {
 
 	switch {
 	case i.selection.Semver != nil:
-		tags, err := i.registry.ListTags(repo)
+		tags, err := i.registry.ListTags(ctx, repo)
 		if err != nil {
 			return "", nil, err
 		}
@@ -62,5 +63,5 @@ func (i TagSelectedImage) URL() (string, []ctlconf.Origin, error) {
 	}
 
 	// tag value is included by ResolvedImage
-	return NewResolvedImage(i.url+":"+tag, i.registry).URL()
+	return NewResolvedImage(i.url+":"+tag, i.registry).URL(ctx)
 }
@@ -4,6 +4,7 @@
 package image
 
 import (
+	"context"
 	regname "github.com/google/go-containerregistry/pkg/name"
 	ctlconf "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/config"
 	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
@@ -20,8 +21,8 @@ func NewTaggedImage(image Image, imgDst ctlconf.ImageDestination, registry ctlre
 	return TaggedImage{image, imgDst, registry}
 }
 
-func (i TaggedImage) URL() (string, []ctlconf.Origin, error) {
-	url, origins, err := i.image.URL()
+func (i TaggedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	url, origins, err := i.image.URL(ctx)
 	if err != nil {
 		return "", nil, err
 	}
@@ -40,7 +41,7 @@ func (i TaggedImage) URL() (string, []ctlconf.Origin, error) {
 		}
 
 		for _, tag := range i.imgDst.Tags {
-			err := i.registry.WriteTag(dstRef.Context().Tag(tag), srcRef)
+			err := i.registry.WriteTag(ctx, dstRef.Context().Tag(tag), srcRef)
 			if err != nil {
 				return "", nil, err
 			}
@@ -5,56 +5,229 @@ package logger
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 )
 
 type Logger struct {
 	writer     io.Writer
 	writerLock *sync.Mutex
+	// logDir (if set) receives output of each prefixed writer in its own file
+	logDir  string
+	secrets *secretValues
 }
 
 func NewLogger(writer io.Writer) Logger {
-	return Logger{writer: writer, writerLock: &sync.Mutex{}}
+	return Logger{writer: writer, writerLock: &sync.Mutex{}, secrets: &secretValues{}}
+}
+
+// Redact makes all prefixed writers (including already created ones)
+// replace given values (e.g. build secrets) in their output
+func (l Logger) Redact(values ...string) {
+	l.secrets.Add(values...)
+}
+
+// WithLogDir returns logger that writes prefixed output into
+// separate files within directory (named after prefix) instead of writer
+func (l Logger) WithLogDir(dir string) Logger {
+	l.logDir = dir
+	return l
 }
 
 func (l Logger) NewPrefixedWriter(prefix string) *PrefixWriter {
-	return &PrefixWriter{prefix, l.writer, l.writerLock}
+	if len(l.logDir) > 0 {
+		// Output already belongs to a single file hence prefix is not necessary
+		return &PrefixWriter{"", fileWriter{l.LogPath(prefix)}, l.writerLock, l.secrets, nil}
+	}
+	return &PrefixWriter{prefix, l.writer, l.writerLock, l.secrets, nil}
+}
+
+var (
+	logFileNameUnsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// LogPath returns path of the file used for prefixed writer
+// with given prefix (e.g. 'image | ') when log directory is set.
+// File name includes hash of the prefix since different prefixes
+// (e.g. 'app:v1' and 'app_v1') may end up with the same safe name.
+func (l Logger) LogPath(prefix string) string {
+	name := strings.TrimSuffix(prefix, " | ")
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+	name = strings.Trim(logFileNameUnsafeChars.ReplaceAllString(name, "_"), "_.")
+	return filepath.Join(l.logDir, name+"-"+hash[:12]+".log")
+}
+
+type fileWriter struct {
+	path string
+}
+
+func (w fileWriter) Write(data []byte) (int, error) {
+	file, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	defer file.Close()
+
+	return file.Write(data)
 }
 
 type PrefixWriter struct {
 	prefix     string
 	writer     io.Writer
 	writerLock *sync.Mutex
+	secrets    *secretValues
+
+	// pending holds last line of previous write when
+	// it ended with what could be a start of a secret
+	pending []byte
 }
 
 func (w *PrefixWriter) Write(data []byte) (int, error) {
-	newData := make([]byte, len(data))
-	copy(newData, data)
+	w.writerLock.Lock()
+	defer w.writerLock.Unlock()
 
-	endsWithNl := bytes.HasSuffix(newData, []byte("\n"))
-	if endsWithNl {
-		newData = newData[0 : len(newData)-1]
+	newData := make([]byte, 0, len(w.pending)+len(data))
+	newData = append(newData, w.pending...)
+	newData = append(newData, data...)
+	w.pending = nil
+
+	// Secret may be split across multiple writes (e.g. command output
+	// is read in chunks), hence hold back last line until next write
+	if idx := w.secrets.PartialSuffixIndex(newData); idx >= 0 {
+		lineStart := bytes.LastIndexByte(newData[:idx], '\n') + 1
+		w.pending = append([]byte{}, newData[lineStart:]...)
+		newData = newData[:lineStart]
+	}
+
+	if len(newData) == 0 {
+		return len(data), nil
+	}
+
+	err := w.write(newData)
+	if err != nil {
+		return 0, err
 	}
-	newData = bytes.Replace(newData, []byte("\n"), []byte("\n"+w.prefix), -1)
-	newData = append(newData, []byte("\n")...)
-	newData = append([]byte(w.prefix), newData...)
 
+	// return original data length
+	return len(data), nil
+}
+
+// Flush writes out output held back due to a possible start of a secret.
+// It should be called once underlying command (or other source) finished writing.
+func (w *PrefixWriter) Flush() error {
 	w.writerLock.Lock()
 	defer w.writerLock.Unlock()
 
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	data := w.pending
+	w.pending = nil
+
+	return w.write(data)
+}
+
+func (w *PrefixWriter) write(data []byte) error {
+	data = w.secrets.Redact(data)
+
+	endsWithNl := bytes.HasSuffix(data, []byte("\n"))
+	if endsWithNl {
+		data = data[0 : len(data)-1]
+	}
+	data = bytes.Replace(data, []byte("\n"), []byte("\n"+w.prefix), -1)
+	data = append(data, []byte("\n")...)
+	data = append([]byte(w.prefix), data...)
+
 	// TODO does not deal with races of multitple writers
-	_, err := w.writer.Write(newData)
+	_, err := w.writer.Write(data)
 	if err != nil {
-		return 0, fmt.Errorf("write err: %s", err)
+		return fmt.Errorf("write err: %s", err)
 	}
 
-	// return original data length
-	return len(data), nil
+	return nil
 }
 
 func (w *PrefixWriter) WriteStr(str string, args ...interface{}) error {
 	_, err := w.Write([]byte(fmt.Sprintf(str, args...)))
 	return err
 }
+
+const (
+	redactedValue = "<redacted>"
+)
+
+type secretValues struct {
+	values []string
+	lock   sync.RWMutex
+}
+
+func (s *secretValues) Add(values ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, val := range values {
+		if len(val) > 0 {
+			s.values = append(s.values, val)
+		}
+	}
+
+	// Replace longer values first so that their parts
+	// (e.g. individual lines) do not prevent full match
+	sort.SliceStable(s.values, func(i, j int) bool { return len(s.values[i]) > len(s.values[j]) })
+}
+
+func (s *secretValues) Redact(data []byte) []byte {
+	if s == nil {
+		return data
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, val := range s.values {
+		data = bytes.Replace(data, []byte(val), []byte(redactedValue), -1)
+	}
+	return data
+}
+
+// PartialSuffixIndex returns index at which data ends with
+// an incomplete secret value (or -1 if it does not). Only first line
+// of multi-line values is considered since they are also redacted line by line.
+func (s *secretValues) PartialSuffixIndex(data []byte) int {
+	if s == nil {
+		return -1
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	idx := -1
+
+	for _, val := range s.values {
+		if nlIdx := strings.IndexByte(val, '\n'); nlIdx >= 0 {
+			val = val[:nlIdx+1]
+		}
+		for i := len(val) - 1; i > 0; i-- {
+			if i > len(data) {
+				continue
+			}
+			if bytes.HasSuffix(data, []byte(val[:i])) {
+				if sufIdx := len(data) - i; idx == -1 || sufIdx < idx {
+					idx = sufIdx
+				}
+				break
+			}
+		}
+	}
+
+	return idx
+}
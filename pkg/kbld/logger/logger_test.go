@@ -5,6 +5,9 @@ package logger_test
 
 import (
 	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
@@ -41,3 +44,119 @@ prefix:
 		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
 	}
 }
+
+func TestLoggerWithLogDir(t *testing.T) {
+	var buf bytes.Buffer
+
+	logDir := t.TempDir()
+	logger := ctllog.NewLogger(&buf).WithLogDir(logDir)
+
+	logger.NewPrefixedWriter("registry.io/app | ").Write([]byte("content1\ncontent2\n"))
+	logger.NewPrefixedWriter("registry.io/app | ").Write([]byte("content3"))
+	logger.NewPrefixedWriter("other | ").Write([]byte("content4\n"))
+
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no output, but was >>>%s<<<", buf.String())
+	}
+
+	logPath := logger.LogPath("registry.io/app | ")
+	logName := filepath.Base(logPath)
+	if filepath.Dir(logPath) != logDir || !strings.HasPrefix(logName, "registry.io_app-") || !strings.HasSuffix(logName, ".log") {
+		t.Fatalf("Expected log path to be within log dir, but was '%s'", logPath)
+	}
+
+	// Prefixes that only differ in unsafe chars use different files
+	if logger.LogPath("app:v1 | ") == logger.LogPath("app_v1 | ") {
+		t.Fatalf("Expected log paths for different prefixes to differ")
+	}
+
+	bs, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Reading log: %s", err)
+	}
+
+	expectedOut := "content1\ncontent2\ncontent3\n"
+	if string(bs) != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", bs, expectedOut)
+	}
+}
+
+func TestLoggerRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := ctllog.NewLogger(&buf)
+	prefLogger := logger.NewPrefixedWriter("prefix: ")
+
+	logger.Redact("line1\nline2", "line1", "token123")
+
+	prefLogger.Write([]byte("using token123\n"))
+	prefLogger.Write([]byte("line1\nline2\n"))
+	prefLogger.Write([]byte("line1\n"))
+
+	out := buf.String()
+	expectedOut := `prefix: using <redacted>
+prefix: <redacted>
+prefix: <redacted>
+`
+
+	if out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+}
+
+func TestLoggerRedactsSecretsSplitAcrossWrites(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := ctllog.NewLogger(&buf)
+	prefLogger := logger.NewPrefixedWriter("prefix: ")
+
+	logger.Redact("token123")
+
+	prefLogger.Write([]byte("before\nusing tok"))
+	prefLogger.Write([]byte("en123\n"))
+	prefLogger.Write([]byte("after to"))
+	prefLogger.Write([]byte("day\n"))
+
+	out := buf.String()
+	expectedOut := `prefix: before
+prefix: using <redacted>
+prefix: after today
+`
+
+	if out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+}
+
+func TestLoggerFlushesOutputEndingWithPartialSecret(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := ctllog.NewLogger(&buf)
+	prefLogger := logger.NewPrefixedWriter("prefix: ")
+
+	logger.Redact("token123")
+
+	prefLogger.Write([]byte("done\nlast t"))
+
+	expectedOut := "prefix: done\n"
+
+	if out := buf.String(); out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+
+	err := prefLogger.Flush()
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	prefLogger.Write([]byte("finished\n"))
+
+	expectedOut = `prefix: done
+prefix: last t
+prefix: finished
+`
+
+	if out := buf.String(); out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+}
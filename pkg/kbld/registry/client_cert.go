@@ -0,0 +1,83 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// ClientCert is used for mutual TLS authentication with registries
+type ClientCert struct {
+	CertPath    string
+	KeyPath     string
+	KeyPassword string // only necessary for encrypted keys
+}
+
+func (c ClientCert) IsSet() bool { return len(c.CertPath) > 0 }
+
+func (c ClientCert) Load() (tls.Certificate, error) {
+	certPEM, err := ioutil.ReadFile(c.CertPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Reading client certificate from '%s': %s", c.CertPath, err)
+	}
+
+	keyPEM, err := ioutil.ReadFile(c.KeyPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Reading client key from '%s': %s", c.KeyPath, err)
+	}
+
+	keyPEM, err = c.decryptKey(keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Decrypting client key from '%s': %s", c.KeyPath, err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("Loading client certificate from '%s': %s", c.CertPath, err)
+	}
+
+	return cert, nil
+}
+
+func (c ClientCert) decryptKey(keyPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("Expected to find PEM encoded key")
+	}
+
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		if len(c.KeyPassword) == 0 {
+			return nil, fmt.Errorf("Expected key password to be specified for encrypted key")
+		}
+
+		keyDER, err := decryptPKCS8(block.Bytes, []byte(c.KeyPassword))
+		if err != nil {
+			return nil, err
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+
+	// Legacy PEM encryption (Proc-Type: 4,ENCRYPTED) is still produced by
+	// some tools (e.g. 'openssl ec -aes256') hence continue to support it
+	case x509.IsEncryptedPEMBlock(block):
+		if len(c.KeyPassword) == 0 {
+			return nil, fmt.Errorf("Expected key password to be specified for encrypted key")
+		}
+
+		keyDER, err := x509.DecryptPEMBlock(block, []byte(c.KeyPassword))
+		if err != nil {
+			return nil, err
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: keyDER}), nil
+
+	default:
+		return keyPEM, nil
+	}
+}
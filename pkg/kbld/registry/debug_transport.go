@@ -0,0 +1,147 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+)
+
+var (
+	// Headers returned by registries (e.g. Docker Hub) to communicate rate limits
+	debugRateLimitHeaders = []string{
+		"RateLimit-Limit",
+		"RateLimit-Remaining",
+		"X-RateLimit-Limit",
+		"X-RateLimit-Remaining",
+		"X-RateLimit-Reset",
+		"Retry-After",
+	}
+)
+
+type debugLogPrefixKey struct{}
+
+// WithDebugLogPrefix associates log prefix (e.g. image URL) with
+// registry requests made using returned context
+func WithDebugLogPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, debugLogPrefixKey{}, prefix)
+}
+
+// debugRoundTripper logs each request made to registries
+// and keeps track of request counts per registry
+type debugRoundTripper struct {
+	delegate http.RoundTripper
+	logger   ctllog.Logger
+	stats    *debugStats
+}
+
+var _ http.RoundTripper = debugRoundTripper{}
+
+func (t debugRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	startTime := time.Now()
+
+	resp, err := t.delegate.RoundTrip(req)
+
+	t.stats.Add(req.URL.Host, resp, err)
+
+	desc := fmt.Sprintf("%s %s%s", req.Method, t.redactedURL(req), t.redactedAuthHeader(req))
+
+	if err != nil {
+		t.logWriter(req).WriteStr("%s -> error: %s (%s)\n", desc, err, time.Since(startTime))
+	} else {
+		t.logWriter(req).WriteStr("%s -> %d (%s)%s\n", desc, resp.StatusCode,
+			time.Since(startTime), t.rateLimitHeaders(resp))
+	}
+
+	return resp, err
+}
+
+func (t debugRoundTripper) logWriter(req *http.Request) *ctllog.PrefixWriter {
+	prefix := "registry"
+	if ctxPrefix, ok := req.Context().Value(debugLogPrefixKey{}).(string); ok && len(ctxPrefix) > 0 {
+		prefix = ctxPrefix
+	}
+	return t.logger.NewPrefixedWriter(prefix + " | registry debug: ")
+}
+
+func (debugRoundTripper) redactedURL(req *http.Request) string {
+	// Query params may include signatures (e.g. blob storage redirects)
+	urlStr := req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+	if len(req.URL.RawQuery) > 0 {
+		urlStr += "?<redacted>"
+	}
+	return urlStr
+}
+
+func (debugRoundTripper) redactedAuthHeader(req *http.Request) string {
+	authHeader := req.Header.Get("Authorization")
+	if len(authHeader) == 0 {
+		return ""
+	}
+	// Keep scheme (e.g. Basic, Bearer) since it helps to debug auth issues
+	scheme := strings.SplitN(authHeader, " ", 2)[0]
+	return fmt.Sprintf(" (authorization: %s <redacted>)", scheme)
+}
+
+func (debugRoundTripper) rateLimitHeaders(resp *http.Response) string {
+	var pairs []string
+	for _, header := range debugRateLimitHeaders {
+		if val := resp.Header.Get(header); len(val) > 0 {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", strings.ToLower(header), val))
+		}
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(pairs, ", ") + ")"
+}
+
+type debugStats struct {
+	hosts     map[string]debugHostStats
+	hostsLock sync.Mutex
+}
+
+type debugHostStats struct {
+	Requests int
+	Errors   int
+}
+
+func newDebugStats() *debugStats {
+	return &debugStats{hosts: map[string]debugHostStats{}}
+}
+
+func (s *debugStats) Add(host string, resp *http.Response, err error) {
+	s.hostsLock.Lock()
+	defer s.hostsLock.Unlock()
+
+	stats := s.hosts[host]
+	stats.Requests++
+	if err != nil || resp.StatusCode >= 400 {
+		stats.Errors++
+	}
+	s.hosts[host] = stats
+}
+
+func (s *debugStats) Write(logger *ctllog.PrefixWriter) {
+	s.hostsLock.Lock()
+	defer s.hostsLock.Unlock()
+
+	var hosts []string
+	for host := range s.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		stats := s.hosts[host]
+		logger.WriteStr("%s: %d requests (%d failed)\n", host, stats.Requests, stats.Errors)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+func TestRegistryDebugLogging(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("RateLimit-Remaining", "5")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Parsing server URL: %s", err)
+	}
+
+	var buf bytes.Buffer
+	logger := ctllog.NewLogger(&buf)
+
+	registry, err := ctlreg.NewRegistry(ctlreg.Opts{
+		VerifyCerts:   true,
+		Insecure:      true,
+		EnvAuthPrefix: "KBLD_TEST_REGISTRY",
+		DebugLogger:   &logger,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	ref, err := regname.NewTag(serverURL.Host+"/repo:tag", regname.Insecure)
+	if err != nil {
+		t.Fatalf("Parsing ref: %s", err)
+	}
+
+	ctx := ctlreg.WithDebugLogPrefix(context.Background(), "my-app")
+
+	_, err = registry.Generic(ctx, ref)
+	if err == nil {
+		t.Fatalf("Expected error for missing manifest, but was nil")
+	}
+
+	registry.WriteDebugSummary()
+
+	out := regexp.MustCompile(`\([0-9.]+[µnm]?s\)`).ReplaceAllString(buf.String(), "(DURATION)")
+
+	// Insecure registries are first tried over https
+	expectedLines := []string{
+		"my-app | registry debug: GET http://" + serverURL.Host + "/v2/ -> 200 (DURATION)",
+		"my-app | registry debug: GET http://" + serverURL.Host + "/v2/repo/manifests/tag -> 404 (DURATION) (ratelimit-remaining=5)",
+		"registry | debug summary: " + serverURL.Host + ": 3 requests (2 failed)",
+	}
+
+	for _, line := range expectedLines {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("Expected output >>>%s<<< to include >>>%s<<<", out, line)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package registry
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -17,6 +18,7 @@ import (
 //   export KBLD_REGISTRY_HOSTNAME_0=...
 //   export KBLD_REGISTRY_USERNAME_0=...
 //   export KBLD_REGISTRY_PASSWORD_0=...
+// (see EnvKeychain.HostOpts for transport related env vars)
 
 type EnvKeychain struct {
 	globalPrefix string
@@ -40,6 +42,10 @@ func (k *EnvKeychain) Resolve(target regauthn.Resource) (regauthn.Authenticator,
 	}
 
 	for _, info := range infos {
+		// Hosts may only have transport settings configured
+		if !info.hasAuth() {
+			continue
+		}
 		if info.Hostname == target.RegistryStr() {
 			return regauthn.FromConfig(regauthn.AuthConfig{
 				Username:      info.Username,
@@ -58,6 +64,18 @@ type envKeychainInfo struct {
 	Password      string
 	IdentityToken string
 	RegistryToken string
+
+	CACertPath        string
+	ClientCertPath    string
+	ClientKeyPath     string
+	ClientKeyPassword string
+	VerifyCerts       *bool
+	Insecure          *bool
+}
+
+func (i envKeychainInfo) hasAuth() bool {
+	return len(i.Username) > 0 || len(i.Password) > 0 ||
+		len(i.IdentityToken) > 0 || len(i.RegistryToken) > 0
 }
 
 func (k *EnvKeychain) collect() ([]envKeychainInfo, error) {
@@ -97,6 +115,38 @@ func (k *EnvKeychain) collect() ([]envKeychainInfo, error) {
 			info.RegistryToken = val
 			return nil
 		},
+		"CA_CERT_PATH": func(info *envKeychainInfo, val string) error {
+			info.CACertPath = val
+			return nil
+		},
+		"CLIENT_CERT_PATH": func(info *envKeychainInfo, val string) error {
+			info.ClientCertPath = val
+			return nil
+		},
+		"CLIENT_KEY_PATH": func(info *envKeychainInfo, val string) error {
+			info.ClientKeyPath = val
+			return nil
+		},
+		"CLIENT_KEY_PASSWORD": func(info *envKeychainInfo, val string) error {
+			info.ClientKeyPassword = val
+			return nil
+		},
+		"VERIFY_CERTS": func(info *envKeychainInfo, val string) error {
+			verifyCerts, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("Parsing registry verify certs: %s (e.g. true, false)", err)
+			}
+			info.VerifyCerts = &verifyCerts
+			return nil
+		},
+		"INSECURE": func(info *envKeychainInfo, val string) error {
+			insecure, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("Parsing registry insecure: %s (e.g. true, false)", err)
+			}
+			info.Insecure = &insecure
+			return nil
+		},
 	}
 
 	defaultInfo := envKeychainInfo{}
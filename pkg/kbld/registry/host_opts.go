@@ -0,0 +1,121 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"fmt"
+)
+
+// HostOpts overrides transport settings for a single registry host
+type HostOpts struct {
+	Hostname string
+
+	CACertPaths       []string
+	ClientCertPath    string
+	ClientKeyPath     string
+	ClientKeyPassword string
+
+	// VerifyCerts and Insecure default to global Opts values when nil
+	VerifyCerts *bool
+	Insecure    *bool
+}
+
+// Env vars with optional suffix (hostname is required)
+// (CA certificate, verify certs and insecure settings
+// may also be provided via --registry-host-* flags):
+//   export KBLD_REGISTRY_HOSTNAME_0=...
+//   export KBLD_REGISTRY_CA_CERT_PATH_0=...
+//   export KBLD_REGISTRY_CLIENT_CERT_PATH_0=...
+//   export KBLD_REGISTRY_CLIENT_KEY_PATH_0=...
+//   export KBLD_REGISTRY_CLIENT_KEY_PASSWORD_0=...
+//   export KBLD_REGISTRY_VERIFY_CERTS_0=false
+//   export KBLD_REGISTRY_INSECURE_0=true
+//
+// Client certificate env vars without hostname apply to all registries:
+//   export KBLD_REGISTRY_CLIENT_CERT_PATH=...
+//   export KBLD_REGISTRY_CLIENT_KEY_PATH=...
+//   export KBLD_REGISTRY_CLIENT_KEY_PASSWORD=...
+
+// HostOpts returns registry transport settings configured via env vars
+func (k *EnvKeychain) HostOpts() ([]HostOpts, error) {
+	infos, err := k.collect()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []HostOpts
+
+	for _, info := range infos {
+		if !info.hasHostOpts() {
+			continue
+		}
+		if len(info.Hostname) == 0 {
+			if info.hasHostOnlyOpts() {
+				return nil, fmt.Errorf("Expected registry hostname to be specified for registry transport settings")
+			}
+			// Included in DefaultHostOpts
+			continue
+		}
+
+		opts := HostOpts{
+			Hostname:          info.Hostname,
+			ClientCertPath:    info.ClientCertPath,
+			ClientKeyPath:     info.ClientKeyPath,
+			ClientKeyPassword: info.ClientKeyPassword,
+			VerifyCerts:       info.VerifyCerts,
+			Insecure:          info.Insecure,
+		}
+		if len(info.CACertPath) > 0 {
+			opts.CACertPaths = []string{info.CACertPath}
+		}
+
+		result = append(result, opts)
+	}
+
+	return result, nil
+}
+
+// DefaultHostOpts returns client certificate settings
+// configured via env vars without a hostname
+func (k *EnvKeychain) DefaultHostOpts() (HostOpts, error) {
+	infos, err := k.collect()
+	if err != nil {
+		return HostOpts{}, err
+	}
+
+	for _, info := range infos {
+		if len(info.Hostname) == 0 {
+			return HostOpts{
+				ClientCertPath:    info.ClientCertPath,
+				ClientKeyPath:     info.ClientKeyPath,
+				ClientKeyPassword: info.ClientKeyPassword,
+			}, nil
+		}
+	}
+
+	return HostOpts{}, nil
+}
+
+func (i envKeychainInfo) hasHostOpts() bool {
+	return len(i.ClientCertPath) > 0 || len(i.ClientKeyPath) > 0 ||
+		len(i.ClientKeyPassword) > 0 || i.hasHostOnlyOpts()
+}
+
+func (i envKeychainInfo) hasHostOnlyOpts() bool {
+	return len(i.CACertPath) > 0 || i.VerifyCerts != nil || i.Insecure != nil
+}
+
+func (o HostOpts) Validate() error {
+	if len(o.Hostname) == 0 {
+		return fmt.Errorf("Expected hostname to be non-empty")
+	}
+	return validateClientCert(o.ClientCertPath, o.ClientKeyPath)
+}
+
+func validateClientCert(certPath, keyPath string) error {
+	if (len(certPath) > 0) != (len(keyPath) > 0) {
+		return fmt.Errorf("Expected both client certificate and key to be specified")
+	}
+	return nil
+}
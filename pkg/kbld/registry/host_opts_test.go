@@ -0,0 +1,66 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"reflect"
+	"testing"
+
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+func TestEnvKeychainHostOpts(t *testing.T) {
+	t.Setenv("KBLD_TEST_REGISTRY_HOSTNAME_0", "internal.registry.io")
+	t.Setenv("KBLD_TEST_REGISTRY_CA_CERT_PATH_0", "/tmp/ca.crt")
+	t.Setenv("KBLD_TEST_REGISTRY_HOSTNAME_1", "localhost:5000")
+	t.Setenv("KBLD_TEST_REGISTRY_INSECURE_1", "true")
+	t.Setenv("KBLD_TEST_REGISTRY_VERIFY_CERTS_1", "false")
+	t.Setenv("KBLD_TEST_REGISTRY_HOSTNAME_2", "gcr.io")
+	t.Setenv("KBLD_TEST_REGISTRY_USERNAME_2", "user")
+
+	hostsOpts, err := ctlreg.NewEnvKeychain("KBLD_TEST_REGISTRY").HostOpts()
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	trueVal := true
+	falseVal := false
+
+	expectedHostsOpts := map[string]ctlreg.HostOpts{
+		"internal.registry.io": {
+			Hostname:    "internal.registry.io",
+			CACertPaths: []string{"/tmp/ca.crt"},
+		},
+		"localhost:5000": {
+			Hostname:    "localhost:5000",
+			VerifyCerts: &falseVal,
+			Insecure:    &trueVal,
+		},
+	}
+
+	if len(hostsOpts) != len(expectedHostsOpts) {
+		t.Fatalf("Expected to find %d host settings, but found %#v", len(expectedHostsOpts), hostsOpts)
+	}
+
+	for _, hostOpts := range hostsOpts {
+		if !reflect.DeepEqual(hostOpts, expectedHostsOpts[hostOpts.Hostname]) {
+			t.Fatalf("Expected host settings >>>%#v<<< to match >>>%#v<<<",
+				hostOpts, expectedHostsOpts[hostOpts.Hostname])
+		}
+	}
+}
+
+func TestEnvKeychainHostOptsWithoutHostname(t *testing.T) {
+	t.Setenv("KBLD_TEST_REGISTRY_CA_CERT_PATH", "/tmp/ca.crt")
+
+	_, err := ctlreg.NewEnvKeychain("KBLD_TEST_REGISTRY").HostOpts()
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected registry hostname to be specified for registry transport settings"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error >>>%s<<< to match >>>%s<<<", err, expectedErr)
+	}
+}
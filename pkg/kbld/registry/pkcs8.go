@@ -0,0 +1,176 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// Encrypted PKCS#8 keys (RFC 5958) are only supported with PBES2
+// (PBKDF2 key derivation) since that's what OpenSSL produces by default
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	pkcs8PRFs = map[string]func() hash.Hash{
+		asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}.String():  sha1.New,
+		asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}.String():  sha256.New,
+		asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}.String(): sha512.New384,
+		asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}.String(): sha512.New,
+	}
+
+	pkcs8Ciphers = map[string]pkcs8Cipher{
+		asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}.String():  {16, aes.NewCipher},
+		asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}.String(): {24, aes.NewCipher},
+		asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}.String(): {32, aes.NewCipher},
+		asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}.String():         {24, des.NewTripleDESCipher},
+	}
+)
+
+type pkcs8Cipher struct {
+	keyLen   int
+	newBlock func([]byte) (cipher.Block, error)
+}
+
+type pkcs8EncryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pkcs8PBES2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pkcs8PBKDF2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 returns DER encoded PKCS#8 private key
+// from DER encoded EncryptedPrivateKeyInfo
+func decryptPKCS8(der []byte, password []byte) ([]byte, error) {
+	var keyInfo pkcs8EncryptedPrivateKeyInfo
+
+	_, err := asn1.Unmarshal(der, &keyInfo)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing encrypted PKCS#8 key: %s", err)
+	}
+
+	if !keyInfo.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("Unsupported PKCS#8 encryption algorithm '%s' (only PBES2 is supported)",
+			keyInfo.EncryptionAlgorithm.Algorithm)
+	}
+
+	var params pkcs8PBES2Params
+
+	_, err = asn1.Unmarshal(keyInfo.EncryptionAlgorithm.Parameters.FullBytes, &params)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing PBES2 parameters: %s", err)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("Unsupported PBES2 key derivation function '%s' (only PBKDF2 is supported)",
+			params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdfParams pkcs8PBKDF2Params
+
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing PBKDF2 parameters: %s", err)
+	}
+
+	prf := sha1.New // default per RFC 8018
+	if len(kdfParams.PRF.Algorithm) > 0 {
+		var found bool
+		prf, found = pkcs8PRFs[kdfParams.PRF.Algorithm.String()]
+		if !found {
+			return nil, fmt.Errorf("Unsupported PBKDF2 pseudorandom function '%s'", kdfParams.PRF.Algorithm)
+		}
+	}
+
+	encCipher, found := pkcs8Ciphers[params.EncryptionScheme.Algorithm.String()]
+	if !found {
+		return nil, fmt.Errorf("Unsupported PBES2 encryption scheme '%s'", params.EncryptionScheme.Algorithm)
+	}
+
+	var iv []byte
+
+	_, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing PBES2 encryption scheme IV: %s", err)
+	}
+
+	key := pbkdf2(password, kdfParams.Salt, kdfParams.IterationCount, encCipher.keyLen, prf)
+
+	block, err := encCipher.newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := keyInfo.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("Expected encrypted data and IV to match cipher block size")
+	}
+
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	// Invalid padding is the most likely outcome of using wrong password
+	padLen := int(decrypted[len(decrypted)-1])
+	if padLen == 0 || padLen > block.BlockSize() ||
+		!bytes.Equal(decrypted[len(decrypted)-padLen:], bytes.Repeat([]byte{byte(padLen)}, padLen)) {
+		return nil, fmt.Errorf("Decryption failed (incorrect password?)")
+	}
+
+	return decrypted[:len(decrypted)-padLen], nil
+}
+
+// pbkdf2 derives key as described in RFC 8018 section 5.2
+func pbkdf2(password, salt []byte, iterations, keyLen int, prf func() hash.Hash) []byte {
+	mac := hmac.New(prf, password)
+
+	var result []byte
+
+	for blockIdx := uint32(1); len(result) < keyLen; blockIdx++ {
+		var blockIdxBytes [4]byte
+		binary.BigEndian.PutUint32(blockIdxBytes[:], blockIdx)
+
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write(blockIdxBytes[:])
+		u := mac.Sum(nil)
+
+		t := append([]byte{}, u...)
+
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+
+		result = append(result, t...)
+	}
+
+	return result[:keyLen]
+}
@@ -4,18 +4,23 @@
 package registry
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	regauthn "github.com/google/go-containerregistry/pkg/authn"
 	regname "github.com/google/go-containerregistry/pkg/name"
 	regv1 "github.com/google/go-containerregistry/pkg/v1"
 	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	ctllog "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/logger"
+	"golang.org/x/net/http/httpproxy"
 )
 
 type Opts struct {
@@ -23,23 +28,81 @@ type Opts struct {
 	VerifyCerts   bool
 	Insecure      bool
 	EnvAuthPrefix string
+
+	ClientCertPath    string
+	ClientKeyPath     string
+	ClientKeyPassword string
+
+	// Unset (nil) values fall back to defaults; zero disables limit
+	DialTimeout           *time.Duration
+	TLSHandshakeTimeout   *time.Duration
+	ResponseHeaderTimeout *time.Duration
+	IdleConnTimeout       *time.Duration
+	MaxIdleConns          *int
+
+	// Proxies fall back to HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    []string
+
+	// OperationTimeout limits duration of each registry operation
+	// including retries (e.g. fetching or writing an image); zero means no limit
+	OperationTimeout time.Duration
+
+	// Hosts are combined with host settings provided via env vars
+	Hosts []HostOpts
+
+	// DebugLogger enables logging of each registry request when set
+	DebugLogger *ctllog.Logger
 }
 
 type Registry struct {
-	opts    []regremote.Option
-	refOpts []regname.Option
+	opts             []regremote.Option
+	insecure         bool
+	insecureHosts    map[string]bool
+	operationTimeout time.Duration
+
+	debugLogger *ctllog.Logger
+	debugStats  *debugStats
 }
 
 func NewRegistry(opts Opts) (Registry, error) {
-	keychain := regauthn.NewMultiKeychain(NewEnvKeychain(opts.EnvAuthPrefix), regauthn.DefaultKeychain)
-	transport, err := newHTTPTransport(opts)
+	envKeychain := NewEnvKeychain(opts.EnvAuthPrefix)
+
+	envHostOpts, err := envKeychain.HostOpts()
 	if err != nil {
 		return Registry{}, err
 	}
 
-	var refOpts []regname.Option
-	if opts.Insecure {
-		refOpts = append(refOpts, regname.Insecure)
+	opts, err = withDefaultEnvHostOpts(opts, envKeychain)
+	if err != nil {
+		return Registry{}, err
+	}
+
+	hostsOpts, err := normalizeHostsOpts(append(append([]HostOpts{}, opts.Hosts...), envHostOpts...))
+	if err != nil {
+		return Registry{}, err
+	}
+
+	keychain := regauthn.NewMultiKeychain(envKeychain, regauthn.DefaultKeychain)
+
+	transport, err := newHostsHTTPTransport(opts, hostsOpts)
+	if err != nil {
+		return Registry{}, err
+	}
+
+	var stats *debugStats
+
+	if opts.DebugLogger != nil {
+		stats = newDebugStats()
+		transport = debugRoundTripper{transport, *opts.DebugLogger, stats}
+	}
+
+	insecureHosts := map[string]bool{}
+	for _, hostOpts := range hostsOpts {
+		if hostOpts.Insecure != nil {
+			insecureHosts[hostOpts.Hostname] = *hostOpts.Insecure
+		}
 	}
 
 	return Registry{
@@ -47,17 +110,26 @@ func NewRegistry(opts Opts) (Registry, error) {
 			regremote.WithTransport(transport),
 			regremote.WithAuthFromKeychain(keychain),
 		},
-		refOpts: refOpts,
+		insecure:         opts.Insecure,
+		insecureHosts:    insecureHosts,
+		operationTimeout: opts.OperationTimeout,
+		debugLogger:      opts.DebugLogger,
+		debugStats:       stats,
 	}, nil
 }
 
-func (i Registry) Generic(ref regname.Reference) (regv1.Descriptor, error) {
-	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
+func (i Registry) Generic(ctx context.Context, ref regname.Reference) (regv1.Descriptor, error) {
+	ref, err := regname.ParseReference(ref.String(), i.refOpts(ref.Context())...)
 	if err != nil {
 		return regv1.Descriptor{}, err
 	}
 
-	desc, err := regremote.Get(ref, i.opts...)
+	ctx, cancel := i.withOperationTimeout(ctx)
+	defer cancel()
+
+	opts := i.remoteOpts(ctx)
+
+	desc, err := regremote.Get(ref, opts...)
 	if err != nil {
 		return regv1.Descriptor{}, err
 	}
@@ -65,23 +137,38 @@ func (i Registry) Generic(ref regname.Reference) (regv1.Descriptor, error) {
 	return desc.Descriptor, nil
 }
 
-func (i Registry) Image(ref regname.Reference) (regv1.Image, error) {
-	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
+func (i Registry) Image(ctx context.Context, ref regname.Reference) (regv1.Image, error) {
+	ref, err := regname.ParseReference(ref.String(), i.refOpts(ref.Context())...)
+	if err != nil {
+		return nil, err
+	}
+
+	var img regv1.Image
+
+	err = i.withManifestTimeout(ctx, func(ctx context.Context) error {
+		img, err = regremote.Image(ref, i.remoteOpts(ctx)...)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return regremote.Image(ref, i.opts...)
+	return img, nil
 }
 
-func (i Registry) WriteImage(ref regname.Reference, img regv1.Image) error {
-	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
+func (i Registry) WriteImage(ctx context.Context, ref regname.Reference, img regv1.Image) error {
+	ref, err := regname.ParseReference(ref.String(), i.refOpts(ref.Context())...)
 	if err != nil {
 		return err
 	}
 
-	err = i.retry(func() error {
-		return regremote.Write(ref, img, i.opts...)
+	ctx, cancel := i.withOperationTimeout(ctx)
+	defer cancel()
+
+	opts := i.remoteOpts(ctx)
+
+	err = i.retry(ctx, func() error {
+		return regremote.Write(ref, img, opts...)
 	})
 	if err != nil {
 		return fmt.Errorf("Writing image: %s", err)
@@ -90,23 +177,38 @@ func (i Registry) WriteImage(ref regname.Reference, img regv1.Image) error {
 	return nil
 }
 
-func (i Registry) Index(ref regname.Reference) (regv1.ImageIndex, error) {
-	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
+func (i Registry) Index(ctx context.Context, ref regname.Reference) (regv1.ImageIndex, error) {
+	ref, err := regname.ParseReference(ref.String(), i.refOpts(ref.Context())...)
 	if err != nil {
 		return nil, err
 	}
 
-	return regremote.Index(ref, i.opts...)
+	var idx regv1.ImageIndex
+
+	err = i.withManifestTimeout(ctx, func(ctx context.Context) error {
+		idx, err = regremote.Index(ref, i.remoteOpts(ctx)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
 }
 
-func (i Registry) WriteIndex(ref regname.Reference, idx regv1.ImageIndex) error {
-	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
+func (i Registry) WriteIndex(ctx context.Context, ref regname.Reference, idx regv1.ImageIndex) error {
+	ref, err := regname.ParseReference(ref.String(), i.refOpts(ref.Context())...)
 	if err != nil {
 		return err
 	}
 
-	err = i.retry(func() error {
-		return regremote.WriteIndex(ref, idx, i.opts...)
+	ctx, cancel := i.withOperationTimeout(ctx)
+	defer cancel()
+
+	opts := i.remoteOpts(ctx)
+
+	err = i.retry(ctx, func() error {
+		return regremote.WriteIndex(ref, idx, opts...)
 	})
 	if err != nil {
 		return fmt.Errorf("Writing image index: %s", err)
@@ -115,24 +217,29 @@ func (i Registry) WriteIndex(ref regname.Reference, idx regv1.ImageIndex) error
 	return nil
 }
 
-func (i Registry) WriteTag(dstRef regname.Tag, srcRef regname.Digest) error {
-	dstRef, err := regname.NewTag(dstRef.String(), i.refOpts...)
+func (i Registry) WriteTag(ctx context.Context, dstRef regname.Tag, srcRef regname.Digest) error {
+	dstRef, err := regname.NewTag(dstRef.String(), i.refOpts(dstRef.Context())...)
 	if err != nil {
 		return err
 	}
 
-	srcRef, err = regname.NewDigest(srcRef.String(), i.refOpts...)
+	srcRef, err = regname.NewDigest(srcRef.String(), i.refOpts(srcRef.Context())...)
 	if err != nil {
 		return err
 	}
 
-	err = i.retry(func() error {
-		desc, err := regremote.Get(srcRef, i.opts...)
+	ctx, cancel := i.withOperationTimeout(ctx)
+	defer cancel()
+
+	opts := i.remoteOpts(ctx)
+
+	err = i.retry(ctx, func() error {
+		desc, err := regremote.Get(srcRef, opts...)
 		if err != nil {
 			return err
 		}
 
-		return regremote.Tag(dstRef, desc, i.opts...)
+		return regremote.Tag(dstRef, desc, opts...)
 	})
 	if err != nil {
 		return fmt.Errorf("Writing image tag: %s", err)
@@ -141,23 +248,187 @@ func (i Registry) WriteTag(dstRef regname.Tag, srcRef regname.Digest) error {
 	return nil
 }
 
-func (i Registry) ListTags(repo regname.Repository) ([]string, error) {
-	repo, err := regname.NewRepository(repo.Name(), i.refOpts...)
+func (i Registry) ListTags(ctx context.Context, repo regname.Repository) ([]string, error) {
+	repo, err := regname.NewRepository(repo.Name(), i.refOpts(repo)...)
 	if err != nil {
 		return nil, err
 	}
 
-	return regremote.List(repo, i.opts...)
+	ctx, cancel := i.withOperationTimeout(ctx)
+	defer cancel()
+
+	opts := i.remoteOpts(ctx)
+
+	return regremote.List(repo, opts...)
+}
+
+// Delete removes given tag (or manifest if digest is given) from registry.
+// Note that not all registries support deleting tags.
+func (i Registry) Delete(ctx context.Context, ref regname.Reference) error {
+	ref, err := regname.ParseReference(ref.String(), i.refOpts(ref.Context())...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := i.withOperationTimeout(ctx)
+	defer cancel()
+
+	opts := i.remoteOpts(ctx)
+
+	err = i.retry(ctx, func() error {
+		return regremote.Delete(ref, opts...)
+	})
+	if err != nil {
+		return fmt.Errorf("Deleting image reference: %s", err)
+	}
+
+	return nil
+}
+
+func (i Registry) withOperationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.operationTimeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, i.operationTimeout)
+}
+
+// withManifestTimeout applies operation timeout only while manifest is fetched
+// since image and index contents are fetched lazily (with the same context)
+// once they are used, possibly long after operation deadline would have passed.
+// On success derived context cannot be canceled here as it is still used by
+// returned image or index; it is owned by ctx and released once ctx is done
+// (commands pass context that is canceled when they finish). Timer is always stopped.
+func (i Registry) withManifestTimeout(ctx context.Context, fetchFunc func(context.Context) error) error {
+	if i.operationTimeout == 0 {
+		return fetchFunc(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(i.operationTimeout, cancel)
+
+	err := fetchFunc(ctx)
+
+	// Once timer fired, context is canceled and contents cannot be fetched
+	if !timer.Stop() {
+		return fmt.Errorf("Exceeded registry operation timeout (%s)", i.operationTimeout)
+	}
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	// cancel is intentionally not called (see above)
+	return nil
+}
+
+func (i Registry) remoteOpts(ctx context.Context) []regremote.Option {
+	return append(append([]regremote.Option{}, i.opts...), regremote.WithContext(ctx))
 }
 
-func newHTTPTransport(opts Opts) (*http.Transport, error) {
+// WriteDebugSummary logs number of requests made to each registry
+// (only when debug logging is enabled)
+func (i Registry) WriteDebugSummary() {
+	if i.debugLogger == nil {
+		return
+	}
+	i.debugStats.Write(i.debugLogger.NewPrefixedWriter("registry | debug summary: "))
+}
+
+func (i Registry) refOpts(repo regname.Repository) []regname.Option {
+	insecure := i.insecure
+	if hostInsecure, found := i.insecureHosts[repo.RegistryStr()]; found {
+		insecure = hostInsecure
+	}
+	if insecure {
+		return []regname.Option{regname.Insecure}
+	}
+	return nil
+}
+
+func withDefaultEnvHostOpts(opts Opts, envKeychain *EnvKeychain) (Opts, error) {
+	defaultHostOpts, err := envKeychain.DefaultHostOpts()
+	if err != nil {
+		return Opts{}, err
+	}
+
+	// Explicitly provided client certificate takes precedence over env vars
+	if len(opts.ClientCertPath) == 0 && len(opts.ClientKeyPath) == 0 {
+		opts.ClientCertPath = defaultHostOpts.ClientCertPath
+		opts.ClientKeyPath = defaultHostOpts.ClientKeyPath
+	}
+	if len(opts.ClientKeyPassword) == 0 {
+		opts.ClientKeyPassword = defaultHostOpts.ClientKeyPassword
+	}
+
+	err = validateClientCert(opts.ClientCertPath, opts.ClientKeyPath)
+	if err != nil {
+		return Opts{}, fmt.Errorf("Validating registry settings: %s", err)
+	}
+
+	return opts, nil
+}
+
+func normalizeHostsOpts(hostsOpts []HostOpts) ([]HostOpts, error) {
+	var result []HostOpts
+
+	for _, hostOpts := range hostsOpts {
+		err := hostOpts.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("Validating registry '%s' settings: %s", hostOpts.Hostname, err)
+		}
+
+		registry, err := regname.NewRegistry(hostOpts.Hostname, regname.StrictValidation)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing registry hostname: %s (e.g. gcr.io, index.docker.io)", err)
+		}
+
+		// Hostname is matched against request host which
+		// does not include scheme and always includes port if it's specified
+		hostOpts.Hostname = registry.RegistryStr()
+		result = append(result, hostOpts)
+	}
+
+	return result, nil
+}
+
+func newHostsHTTPTransport(opts Opts, hostsOpts []HostOpts) (http.RoundTripper, error) {
+	defaultTransport, err := newHTTPTransport(opts, HostOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hostsOpts) == 0 {
+		return defaultTransport, nil
+	}
+
+	hostTransports := map[string]http.RoundTripper{}
+
+	for _, hostOpts := range hostsOpts {
+		if _, found := hostTransports[hostOpts.Hostname]; found {
+			return nil, fmt.Errorf("Expected registry '%s' settings to be specified only once", hostOpts.Hostname)
+		}
+
+		transport, err := newHTTPTransport(opts, hostOpts)
+		if err != nil {
+			return nil, fmt.Errorf("Configuring transport for registry '%s': %s", hostOpts.Hostname, err)
+		}
+
+		hostTransports[hostOpts.Hostname] = transport
+	}
+
+	return hostRoundTripper{defaultTransport, hostTransports}, nil
+}
+
+func newHTTPTransport(opts Opts, hostOpts HostOpts) (*http.Transport, error) {
 	pool, err := x509.SystemCertPool()
 	if err != nil {
 		pool = x509.NewCertPool()
 	}
 
-	if len(opts.CACertPaths) > 0 {
-		for _, path := range opts.CACertPaths {
+	caCertPaths := append(append([]string{}, opts.CACertPaths...), hostOpts.CACertPaths...)
+
+	if len(caCertPaths) > 0 {
+		for _, path := range caCertPaths {
 			if certs, err := ioutil.ReadFile(path); err != nil {
 				return nil, fmt.Errorf("Reading CA certificates from '%s': %s", path, err)
 			} else if ok := pool.AppendCertsFromPEM(certs); !ok {
@@ -166,37 +437,115 @@ func newHTTPTransport(opts Opts) (*http.Transport, error) {
 		}
 	}
 
+	verifyCerts := opts.VerifyCerts
+	if hostOpts.VerifyCerts != nil {
+		verifyCerts = *hostOpts.VerifyCerts
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:            pool,
+		InsecureSkipVerify: (verifyCerts == false),
+	}
+
+	clientCert := ClientCert{opts.ClientCertPath, opts.ClientKeyPath, opts.ClientKeyPassword}
+	if len(hostOpts.ClientCertPath) > 0 {
+		clientCert = ClientCert{hostOpts.ClientCertPath, hostOpts.ClientKeyPath, hostOpts.ClientKeyPassword}
+	}
+
+	if clientCert.IsSet() {
+		cert, err := clientCert.Load()
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
 	// Copied from https://github.com/golang/go/blob/release-branch.go1.12/src/net/http/transport.go#L42-L53
 	// We want to use the DefaultTransport but change its TLSClientConfig. There
 	// isn't a clean way to do this yet: https://github.com/golang/go/issues/26013
 	return &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
+		Proxy: newProxyFunc(opts),
 		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
+			Timeout:   durationWithDefault(opts.DialTimeout, 30*time.Second),
 			KeepAlive: 30 * time.Second,
 			DualStack: true,
 		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          intWithDefault(opts.MaxIdleConns, 100),
+		IdleConnTimeout:       durationWithDefault(opts.IdleConnTimeout, 90*time.Second),
+		TLSHandshakeTimeout:   durationWithDefault(opts.TLSHandshakeTimeout, 10*time.Second),
+		ResponseHeaderTimeout: durationWithDefault(opts.ResponseHeaderTimeout, 10*time.Second),
 		ExpectContinueTimeout: 1 * time.Second,
 		// Use the cert pool with k8s cert bundle appended.
-		TLSClientConfig: &tls.Config{
-			RootCAs:            pool,
-			InsecureSkipVerify: (opts.VerifyCerts == false),
-		},
+		TLSClientConfig: tlsConfig,
 	}, nil
 }
 
-func (i Registry) retry(doFunc func() error) error {
+func newProxyFunc(opts Opts) func(*http.Request) (*url.URL, error) {
+	if len(opts.HTTPProxy) == 0 && len(opts.HTTPSProxy) == 0 && len(opts.NoProxy) == 0 {
+		return http.ProxyFromEnvironment
+	}
+
+	proxyConfig := httpproxy.FromEnvironment()
+
+	if len(opts.HTTPProxy) > 0 {
+		proxyConfig.HTTPProxy = opts.HTTPProxy
+	}
+	if len(opts.HTTPSProxy) > 0 {
+		proxyConfig.HTTPSProxy = opts.HTTPSProxy
+	}
+	if len(opts.NoProxy) > 0 {
+		proxyConfig.NoProxy = strings.Join(opts.NoProxy, ",")
+	}
+
+	proxyFunc := proxyConfig.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
+func durationWithDefault(val *time.Duration, defaultVal time.Duration) time.Duration {
+	if val == nil {
+		return defaultVal
+	}
+	return *val
+}
+
+func intWithDefault(val *int, defaultVal int) int {
+	if val == nil {
+		return defaultVal
+	}
+	return *val
+}
+
+// hostRoundTripper picks transport based on request's host
+// so that registries may use different TLS settings
+type hostRoundTripper struct {
+	defaultTransport http.RoundTripper
+	hostTransports   map[string]http.RoundTripper
+}
+
+var _ http.RoundTripper = hostRoundTripper{}
+
+func (t hostRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, found := t.hostTransports[req.URL.Host]; found {
+		return transport.RoundTrip(req)
+	}
+	return t.defaultTransport.RoundTrip(req)
+}
+
+func (i Registry) retry(ctx context.Context, doFunc func() error) error {
 	var lastErr error
 	for i := 0; i < 5; i++ {
 		lastErr = doFunc()
 		if lastErr == nil {
 			return nil
 		}
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Retried %d times: %s", i+1, lastErr)
+		case <-time.After(1 * time.Second):
+		}
 	}
 	return fmt.Errorf("Retried 5 times: %s", lastErr)
 }
@@ -0,0 +1,59 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+	"github.com/vmware-tanzu/carvel-kbld/pkg/kbld/testutil"
+)
+
+func TestRegistryImageContentsAreAvailableAfterOperationTimeout(t *testing.T) {
+	host, reg := testutil.NewRegistryWithOpts(t, ctlreg.Opts{OperationTimeout: 100 * time.Millisecond})
+
+	ref, err := regname.NewTag(host + "/app:v1")
+	if err != nil {
+		t.Fatalf("Parsing ref: %s", err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatalf("Building random image: %s", err)
+	}
+
+	err = reg.WriteImage(context.Background(), ref, img)
+	if err != nil {
+		t.Fatalf("Writing image: %s", err)
+	}
+
+	fetchedImg, err := reg.Image(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	// Layers are fetched lazily once operation timeout has passed
+	time.Sleep(200 * time.Millisecond)
+
+	layers, err := fetchedImg.Layers()
+	if err != nil {
+		t.Fatalf("Getting layers: %s", err)
+	}
+
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		t.Fatalf("Expected layer to be fetched, but was: %s", err)
+	}
+	defer rc.Close()
+
+	_, err = ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("Reading layer: %s", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPTransportDefaults(t *testing.T) {
+	transport, err := newHTTPTransport(Opts{}, HostOpts{})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	checkTransportSettings(t, transport, 90*time.Second, 10*time.Second, 10*time.Second, 100)
+}
+
+func TestNewHTTPTransportWithSettings(t *testing.T) {
+	durationPtr := func(d time.Duration) *time.Duration { return &d }
+	intPtr := func(i int) *int { return &i }
+
+	transport, err := newHTTPTransport(Opts{
+		IdleConnTimeout:       durationPtr(1 * time.Second),
+		TLSHandshakeTimeout:   durationPtr(2 * time.Second),
+		ResponseHeaderTimeout: durationPtr(3 * time.Second),
+		MaxIdleConns:          intPtr(4),
+	}, HostOpts{})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	checkTransportSettings(t, transport, 1*time.Second, 2*time.Second, 3*time.Second, 4)
+
+	// Zero values disable limits instead of falling back to defaults
+	transport, err = newHTTPTransport(Opts{
+		IdleConnTimeout:       durationPtr(0),
+		TLSHandshakeTimeout:   durationPtr(0),
+		ResponseHeaderTimeout: durationPtr(0),
+		MaxIdleConns:          intPtr(0),
+	}, HostOpts{})
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	checkTransportSettings(t, transport, 0, 0, 0, 0)
+}
+
+func checkTransportSettings(t *testing.T, transport *http.Transport,
+	idleConnTimeout, tlsHandshakeTimeout, responseHeaderTimeout time.Duration, maxIdleConns int) {
+
+	if transport.IdleConnTimeout != idleConnTimeout {
+		t.Fatalf("Expected idle conn timeout %s, but was %s", idleConnTimeout, transport.IdleConnTimeout)
+	}
+	if transport.TLSHandshakeTimeout != tlsHandshakeTimeout {
+		t.Fatalf("Expected TLS handshake timeout %s, but was %s", tlsHandshakeTimeout, transport.TLSHandshakeTimeout)
+	}
+	if transport.ResponseHeaderTimeout != responseHeaderTimeout {
+		t.Fatalf("Expected response header timeout %s, but was %s", responseHeaderTimeout, transport.ResponseHeaderTimeout)
+	}
+	if transport.MaxIdleConns != maxIdleConns {
+		t.Fatalf("Expected max idle conns %d, but was %d", maxIdleConns, transport.MaxIdleConns)
+	}
+}
+
+func TestNewProxyFunc(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "")
+	t.Setenv("HTTPS_PROXY", "http://env-proxy.io:3128")
+	t.Setenv("NO_PROXY", "")
+
+	proxyFunc := newProxyFunc(Opts{
+		HTTPProxy: "http://proxy.io:3128",
+		NoProxy:   []string{"internal.io", ".corp.io"},
+	})
+
+	cases := []struct {
+		URL           string
+		ExpectedProxy string
+	}{
+		{"http://registry.io/v2/", "http://proxy.io:3128"},
+		// HTTPS proxy falls back to env var since it's not configured
+		{"https://registry.io/v2/", "http://env-proxy.io:3128"},
+		{"https://internal.io/v2/", ""},
+		{"https://registry.corp.io/v2/", ""},
+	}
+
+	for _, c := range cases {
+		reqURL, err := url.Parse(c.URL)
+		if err != nil {
+			t.Fatalf("Parsing URL: %s", err)
+		}
+
+		proxyURL, err := proxyFunc(&http.Request{URL: reqURL})
+		if err != nil {
+			t.Fatalf("Expected no error, but was: %s", err)
+		}
+
+		var proxy string
+		if proxyURL != nil {
+			proxy = proxyURL.String()
+		}
+
+		if proxy != c.ExpectedProxy {
+			t.Fatalf("Expected proxy for %s >>>%s<<< to match >>>%s<<<", c.URL, proxy, c.ExpectedProxy)
+		}
+	}
+}
@@ -21,6 +21,8 @@ type Resource interface {
 
 	Name() string
 	Description() string
+	// Origin describes where resource was read from (e.g. file path)
+	Origin() string
 
 	Annotations() map[string]string
 	Labels() map[string]string
@@ -38,6 +40,7 @@ type ResourceImpl struct {
 	un        unstructured.Unstructured
 	gvr       schema.GroupVersionResource
 	transient bool
+	origin    string
 }
 
 var _ Resource = &ResourceImpl{}
@@ -73,6 +76,10 @@ func MustNewResourceFromBytes(data []byte) *ResourceImpl {
 }
 
 func NewResourcesFromBytes(data []byte) ([]Resource, error) {
+	return newResourcesFromBytes(data, "")
+}
+
+func newResourcesFromBytes(data []byte, origin string) ([]Resource, error) {
 	var rs []Resource
 	var content map[string]interface{}
 
@@ -94,10 +101,10 @@ func NewResourcesFromBytes(data []byte) ([]Resource, error) {
 		}
 
 		for _, itemUn := range list.Items {
-			rs = append(rs, &ResourceImpl{un: itemUn})
+			rs = append(rs, &ResourceImpl{un: itemUn, origin: origin})
 		}
 	} else {
-		rs = append(rs, &ResourceImpl{un: un})
+		rs = append(rs, &ResourceImpl{un: un, origin: origin})
 	}
 
 	return rs, nil
@@ -146,6 +153,8 @@ func (r *ResourceImpl) Description() string {
 	return result
 }
 
+func (r *ResourceImpl) Origin() string { return r.origin }
+
 func (r *ResourceImpl) Annotations() map[string]string { return r.un.GetAnnotations() }
 func (r *ResourceImpl) Labels() map[string]string      { return r.un.GetLabels() }
 
@@ -157,7 +166,7 @@ func (r *ResourceImpl) Equal(res Resource) bool {
 }
 
 func (r *ResourceImpl) DeepCopy() Resource {
-	return &ResourceImpl{*r.un.DeepCopy(), r.gvr, r.transient}
+	return &ResourceImpl{*r.un.DeepCopy(), r.gvr, r.transient, r.origin}
 }
 
 func (r *ResourceImpl) DeepCopyRaw() map[string]interface{} {
@@ -0,0 +1,68 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package testutil provides helpers shared by unit tests.
+// It is only meant to be imported from _test.go files.
+package testutil
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	ctlreg "github.com/vmware-tanzu/carvel-kbld/pkg/kbld/registry"
+)
+
+// NewRegistry starts in-memory registry for the duration of the test
+// and returns its host together with Registry configured to access it
+func NewRegistry(t *testing.T) (string, ctlreg.Registry) {
+	return NewRegistryWithOpts(t, ctlreg.Opts{})
+}
+
+// NewRegistryWithOpts is like NewRegistry but allows to customize
+// registry options (e.g. timeouts); connection options are always set
+func NewRegistryWithOpts(t *testing.T, opts ctlreg.Opts) (string, ctlreg.Registry) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(ioutil.Discard, "", 0))))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Parsing server URL: %s", err)
+	}
+
+	opts.VerifyCerts = true
+	opts.Insecure = true
+	opts.EnvAuthPrefix = "KBLD_TEST_REGISTRY"
+
+	reg, err := ctlreg.NewRegistry(opts)
+	if err != nil {
+		t.Fatalf("Expected no error, but was: %s", err)
+	}
+
+	return serverURL.Host, reg
+}
+
+// WriteCLI writes executable script (including shebang) with given name
+// into temporary directory and returns its path
+func WriteCLI(t *testing.T, name, script string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	err := ioutil.WriteFile(path, []byte(script), 0700)
+	if err != nil {
+		t.Fatalf("Writing %s: %s", name, err)
+	}
+
+	return path
+}
+
+// InstallCLI writes executable shell script with given name and
+// prepends its directory to PATH for the duration of the test
+func InstallCLI(t *testing.T, name, script string) {
+	path := WriteCLI(t, name, script)
+	t.Setenv("PATH", filepath.Dir(path)+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
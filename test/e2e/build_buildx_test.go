@@ -0,0 +1,137 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBuildxBuildSuccessful(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.Namespace, env.KbldBinaryPath, Logger{}}
+
+	input := env.WithRegistries(`
+kind: Object
+spec:
+- image: simple-app-two
+- image: simple-app-three
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Sources
+sources:
+- image: simple-app-two
+  path: assets/simple-app
+  buildx:
+    build:
+      file: dev/Dockerfile.dev
+- image: simple-app-three
+  path: assets/simple-app
+  buildx:
+    build:
+      target: build-env
+      platforms: [linux/amd64]
+`)
+
+	out, _ := kbld.RunWithOpts([]string{"-f", "-", "--images-annotation=false"}, RunOpts{
+		StdinReader: strings.NewReader(input),
+	})
+
+	out = regexp.MustCompile("sha256\\-[a-z0-9]{64}").ReplaceAllString(out, "SHA256-REPLACED")
+
+	expectedOut := `---
+kind: Object
+spec:
+- image: kbld:simple-app-two-SHA256-REPLACED
+- image: kbld:simple-app-three-SHA256-REPLACED
+`
+
+	if out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+}
+
+func TestBuildxBuildMultiPlatformWithoutDestinationFails(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.Namespace, env.KbldBinaryPath, Logger{}}
+
+	input := `
+kind: Object
+spec:
+- image: simple-app
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Sources
+sources:
+- image: simple-app
+  path: assets/simple-app
+  buildx:
+    build:
+      platforms: [linux/amd64, linux/arm64]
+`
+
+	_, err := kbld.RunWithOpts([]string{"-f", "-"}, RunOpts{
+		StdinReader: strings.NewReader(input),
+		AllowError:  true,
+	})
+	if err == nil {
+		t.Fatalf("Expected error, but was nil")
+	}
+
+	expectedErr := "Expected image destination to be specified when building for multiple platforms"
+	if !strings.Contains(err.Error(), expectedErr) {
+		t.Fatalf("Expected error >>>%s<<< to include >>>%s<<<", err, expectedErr)
+	}
+}
+
+func TestBuildxBuildAndPushMultiPlatformSuccessful(t *testing.T) {
+	env := BuildEnv(t)
+
+	if env.SkipWhenHTTPRegistry {
+		fmt.Printf("This is a test that cannot run against HTTP registry; skipping.")
+		return
+	}
+
+	kbld := Kbld{t, env.Namespace, env.KbldBinaryPath, Logger{}}
+
+	input := env.WithRegistries(`
+kind: Object
+spec:
+- image: docker.io/*username*/kbld-e2e-tests-buildx
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Sources
+sources:
+- image: docker.io/*username*/kbld-e2e-tests-buildx
+  path: assets/simple-app
+  buildx:
+    build:
+      platforms: [linux/amd64, linux/arm64]
+      buildArgs:
+        GOPROXY: https://proxy.golang.org
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: ImageDestinations
+destinations:
+- image: docker.io/*username*/kbld-e2e-tests-buildx
+`)
+
+	out, _ := kbld.RunWithOpts([]string{"-f", "-", "--images-annotation=false"}, RunOpts{
+		StdinReader: strings.NewReader(input),
+	})
+
+	out = regexp.MustCompile("sha256:[a-z0-9]{64}").ReplaceAllString(out, "SHA256-REPLACED")
+
+	expectedOut := env.WithRegistries(`---
+kind: Object
+spec:
+- image: index.docker.io/*username*/kbld-e2e-tests-buildx@SHA256-REPLACED
+`)
+
+	if out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+}
@@ -510,3 +510,49 @@ spec:
 		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
 	}
 }
+
+func TestResolvePlanDoesNotBuildOrResolve(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.Namespace, env.KbldBinaryPath, Logger{}}
+
+	input := `
+kind: Object
+spec:
+- image: nginx:1.14.2
+- image: app
+- image: redis
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+sources:
+- image: app
+  path: assets/simple-app
+destinations:
+- image: app
+  newImage: docker.io/dkalinin/simple-app
+overrides:
+- image: redis
+  newImage: redis:6
+`
+
+	out, _ := kbld.RunWithOpts([]string{"-f", "-", "--plan"}, RunOpts{
+		StdinReader: strings.NewReader(input),
+	})
+
+	expectedOut := `app
+  build: build assets/simple-app with docker builder
+    rule: source for image 'app' in stdin
+  push: push to docker.io/dkalinin/simple-app
+    rule: destination for image 'app' in stdin
+nginx:1.14.2
+  resolve: resolve nginx:1.14.2 to digest from registry
+redis
+  override: replace with redis:6
+    rule: override for image 'redis' in stdin
+  resolve: resolve redis:6 to digest from registry
+`
+
+	if out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+}